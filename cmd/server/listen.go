@@ -0,0 +1,159 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc/credentials"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd with socket
+// activation, see sd_listen_fds(3).
+var listenFdsStart = 3
+
+// listen returns the listener to serve on. With systemd socket activation,
+// that's the socket passed by systemd and the address is ignored. Otherwise,
+// it listens on the address, which is a unix:// or tcp:// URL. Paths without
+// a scheme are unix sockets.
+func listen(address string) (net.Listener, error) {
+	l, err := activatedListener()
+	if err != nil || l != nil {
+		return l, err
+	}
+
+	network, addr, err := parseListenAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		return listenUnix(addr)
+	}
+	return net.Listen(network, addr)
+}
+
+// parseListenAddress returns the network and the address to listen on.
+func parseListenAddress(address string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		address = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		return "tcp", strings.TrimPrefix(address, "tcp://"), nil
+	case strings.Contains(address, "://"):
+		return "", "", fmt.Errorf("unsupported address %q, must be a unix:// or tcp:// URL", address)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("no path given for the unix socket")
+	}
+	return "unix", address, nil
+}
+
+// listenUnix listens on a unix socket. A socket left behind by a previous
+// rktlet which didn't exit cleanly is removed first, but not one some other
+// process still listens on.
+func listenUnix(path string) (net.Listener, error) {
+	fi, err := os.Lstat(path)
+	if err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%q exists and isn't a socket", path)
+		}
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another process is listening on %q", path)
+		}
+		if !isConnRefused(err) {
+			return nil, fmt.Errorf("unable to check whether socket %q is stale: %v", path, err)
+		}
+		glog.Infof("Removing stale socket %q", path)
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("unable to remove stale socket %q: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+func isConnRefused(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	return ok && sysErr.Err == syscall.ECONNREFUSED
+}
+
+// activatedListener returns the socket passed by systemd if rktlet was socket
+// activated, and nil otherwise.
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: %v", os.Getenv("LISTEN_FDS"), err)
+	}
+	// The variables are meant for rktlet only, not for the pods it runs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if nfds != 1 {
+		return nil, fmt.Errorf("expected 1 socket from systemd, got %d", nfds)
+	}
+
+	syscall.CloseOnExec(listenFdsStart)
+	f := os.NewFile(uintptr(listenFdsStart), fmt.Sprintf("LISTEN_FD_%d", listenFdsStart))
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket from systemd: %v", err)
+	}
+	return l, nil
+}
+
+// serverCredentials returns the TLS credentials to serve with, requiring
+// clients to present a certificate signed by the client CA if it's given.
+func serverCredentials(certFile, keyFile, clientCAFile string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA: %v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client CA %q", clientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(config), nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	for _, tt := range []struct {
+		address string
+		network string
+		addr    string
+		err     bool
+	}{
+		{"unix:///var/run/rktlet.sock", "unix", "/var/run/rktlet.sock", false},
+		{"/var/run/rktlet.sock", "unix", "/var/run/rktlet.sock", false},
+		{"tcp://127.0.0.1:10240", "tcp", "127.0.0.1:10240", false},
+		{"tcp://:10240", "tcp", ":10240", false},
+		{"unix://", "", "", true},
+		{"http://127.0.0.1:10240", "", "", true},
+	} {
+		network, addr, err := parseListenAddress(tt.address)
+		if tt.err {
+			assert.Error(t, err, tt.address)
+			continue
+		}
+		assert.NoError(t, err, tt.address)
+		assert.Equal(t, tt.network, network, tt.address)
+		assert.Equal(t, tt.addr, addr, tt.address)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_listen")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "rktlet.sock")
+
+	l, err := listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The socket is in use.
+	_, err = listenUnix(path)
+	assert.Error(t, err)
+
+	// The socket is stale.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listenUnix(path)
+	if assert.NoError(t, err) {
+		l.Close()
+	}
+
+	// Other files are left alone.
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("unable to create %q: %v", path, err)
+	}
+	_, err = listenUnix(path)
+	assert.Error(t, err)
+}
+
+func TestActivatedListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The listener takes ownership of the file descriptor passed by systemd.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	origListenFdsStart := listenFdsStart
+	listenFdsStart = fd
+	defer func() { listenFdsStart = origListenFdsStart }()
+
+	// Not socket activated.
+	activated, err := activatedListener()
+	assert.NoError(t, err)
+	assert.Nil(t, activated)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	activated, err = listen("unix:///nonexistent/rktlet.sock")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer activated.Close()
+	assert.Equal(t, l.Addr().String(), activated.Addr().String())
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+}
@@ -18,7 +18,6 @@ package main
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -34,8 +33,6 @@ import (
 	"k8s.io/kubernetes/staging/src/k8s.io/apiserver/pkg/util/flag"
 )
 
-const defaultUnixSock = "/var/run/rktlet.sock"
-
 func printVersion() {
 	fmt.Println("rktlet version:", version.Version)
 }
@@ -55,16 +52,29 @@ func main() {
 	exitCh := make(chan os.Signal, 1)
 	signal.Notify(exitCh, syscall.SIGINT, syscall.SIGTERM)
 
-	socketPath := defaultUnixSock
-	defer os.Remove(socketPath)
-
-	sock, err := net.Listen("unix", socketPath)
+	sock, err := listen(s.Listen)
 	if err != nil {
-		glog.Fatalf("Error listening on sock %q: %v ", socketPath, err)
+		glog.Fatalf("Error listening on %q: %v", s.Listen, err)
 	}
 	defer sock.Close()
 
-	grpcServer := grpc.NewServer()
+	var serverOpts []grpc.ServerOption
+	serverOpts = append(serverOpts, grpc.UnaryInterceptor(rktlet.ErrorCodeInterceptor))
+	if s.TLSCertFile != "" || s.TLSPrivateKeyFile != "" {
+		if sock.Addr().Network() != "tcp" {
+			glog.Fatalf("TLS is only supported when listening on TCP, not on %s %q", sock.Addr().Network(), sock.Addr())
+		}
+		creds, err := serverCredentials(s.TLSCertFile, s.TLSPrivateKeyFile, s.TLSClientCAFile)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	} else if s.TLSClientCAFile != "" {
+		glog.Fatalf("--tls-client-ca-file requires --tls-cert-file and --tls-private-key-file")
+	} else if sock.Addr().Network() == "tcp" {
+		glog.Warningf("Serving on %q without TLS: anyone reaching it can run pods", sock.Addr())
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
 
 	rktruntime, err := rktlet.New(s.Config)
 	if err != nil {
@@ -74,7 +84,7 @@ func main() {
 	runtimeapi.RegisterImageServiceServer(grpcServer, rktruntime)
 	runtimeapi.RegisterRuntimeServiceServer(grpcServer, rktruntime)
 
-	glog.Infof("Starting to serve on %q", socketPath)
+	glog.Infof("Starting to serve on %s %q", sock.Addr().Network(), sock.Addr())
 	go grpcServer.Serve(sock)
 
 	<-exitCh
@@ -25,6 +25,16 @@ import (
 type RktletServer struct {
 	*rktlet.Config
 
+	// Listen is the address to serve the CRI on, a unix:// or tcp:// URL.
+	Listen string
+	// TLSCertFile and TLSPrivateKeyFile are the certificate and key to
+	// serve with over TCP. Without them, TCP connections are insecure.
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	// TLSClientCAFile is the CA the certificates of clients must be signed
+	// by. If it's empty, clients aren't authenticated.
+	TLSClientCAFile string
+
 	ShowVersion bool
 }
 
@@ -32,6 +42,7 @@ func NewRktletServer() *RktletServer {
 	config := rktlet.DefaultConfig
 	return &RktletServer{
 		Config: config,
+		Listen: "unix:///var/run/rktlet.sock",
 	}
 }
 
@@ -40,6 +51,19 @@ func (s *RktletServer) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.RktDatadir, "rkt-data-dir", s.RktDatadir, "Path to rkt's data directory. Defaults to '/var/lib/rktlet/data'.")
 	fs.StringVar(&s.StreamServerAddress, "stream-server-address", s.StreamServerAddress, "Address to listen on for api-server streaming requests. MUST BE SECURED BY SOME EXTERNAL MECHANISM.")
 	fs.StringVar(&s.RktStage1Name, "rkt-stage1-name", s.RktStage1Name, "Name of an image to use as stage1. This needs to be specified as 'image:version'. If the image is present in the local store, the version can be ommitted.")
-	fs.StringVar(&s.NetworkPluginName, "net", "", "Name of the network plugin used in the cluster")
+	fs.StringVar(&s.NetworkPluginName, "net", "", "Name of the network plugin used in the cluster. With 'rkt.kubernetes.io', rktlet configures a bridge network from the pod CIDR of the node.")
+	fs.StringVar(&s.RktLocalConfigDir, "rkt-local-config-dir", s.RktLocalConfigDir, "Path to rkt's local configuration directory, passed to rkt as --local-config. Network configurations are loaded from its 'net.d' subdirectory. Defaults to '/etc/rkt'.")
+	fs.Int64Var(&s.ExecOutputLimit, "exec-output-limit", s.ExecOutputLimit, "Maximum number of bytes of stdout, and of stderr, kept from synchronous execs such as exec probes. 0 means no limit.")
+	fs.DurationVar(&s.StateCacheRefreshPeriod, "state-cache-refresh-period", s.StateCacheRefreshPeriod, "How often pods and containers are relisted from rkt. List requests are served from a cache in between.")
+	fs.StringVar(&s.RktAPIEndpoint, "rkt-api-endpoint", s.RktAPIEndpoint, "Address of a rkt api-service, e.g. 'localhost:15441', to read pods and images from instead of running rkt. Pods and images are still changed by running rkt.")
+	fs.StringVar(&s.CgroupDriver, "cgroup-driver", s.CgroupDriver, "Driver the kubelet uses to manage cgroups, 'systemd' or 'cgroupfs'. Must match the --cgroup-driver flag of the kubelet. 'cgroupfs' requires --init=process.")
+	fs.StringVar(&s.Init, "init", s.Init, "Init system running pod sandboxes, 'systemd', or 'process' to run them as detached children of rktlet on hosts without systemd. Leave empty to use systemd if it's available and the cgroup driver is 'systemd'.")
+	fs.StringVar(&s.ProcessInitDir, "process-init-dir", s.ProcessInitDir, "Path to the directory where the state and the output of pod sandboxes are kept with --init=process.")
+	fs.DurationVar(&s.PodReadyTimeout, "pod-ready-timeout", s.PodReadyTimeout, "How long to wait for a new pod sandbox to be ready before failing to run it.")
+	fs.IntVar(&s.MaxConcurrentRktCommands, "max-concurrent-rkt-commands", s.MaxConcurrentRktCommands, "Maximum number of rkt commands changing pods or images, and of those reading them, run at once. 0 means no limit.")
+	fs.StringVar(&s.Listen, "listen", s.Listen, "Address to serve the CRI on, 'unix:///path/to/socket' or 'tcp://host:port'. Ignored when the socket is passed by systemd socket activation.")
+	fs.StringVar(&s.TLSCertFile, "tls-cert-file", s.TLSCertFile, "Certificate to serve the CRI with over TCP. Without it, TCP connections are neither encrypted nor authenticated.")
+	fs.StringVar(&s.TLSPrivateKeyFile, "tls-private-key-file", s.TLSPrivateKeyFile, "Private key matching --tls-cert-file.")
+	fs.StringVar(&s.TLSClientCAFile, "tls-client-ca-file", s.TLSClientCAFile, "CA the certificates of clients must be signed by when serving over TCP with TLS. Without it, clients aren't authenticated.")
 	fs.BoolVar(&s.ShowVersion, "version", false, "Show version")
 }
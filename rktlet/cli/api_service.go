@@ -0,0 +1,256 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	appcschema "github.com/appc/spec/schema"
+	appctypes "github.com/appc/spec/schema/types"
+	rktapi "github.com/coreos/rkt/api/v1alpha"
+	"github.com/golang/glog"
+	rkt "github.com/rkt/rkt/api/v1"
+	"github.com/rkt/rkt/networking/netinfo"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// apiServiceTimeout is how long to wait for a response of the api-service.
+const apiServiceTimeout = 10 * time.Second
+
+// The pod states of the api-service, as reported by `rkt status`.
+var apiPodStates = map[rktapi.PodState]string{
+	rktapi.PodState_POD_STATE_EMBRYO:          "embryo",
+	rktapi.PodState_POD_STATE_PREPARING:       "preparing",
+	rktapi.PodState_POD_STATE_PREPARED:        "prepared",
+	rktapi.PodState_POD_STATE_RUNNING:         "running",
+	rktapi.PodState_POD_STATE_ABORTED_PREPARE: "aborted prepare",
+	rktapi.PodState_POD_STATE_EXITED:          "exited",
+	rktapi.PodState_POD_STATE_DELETING:        "deleting",
+	rktapi.PodState_POD_STATE_GARBAGE:         "garbage",
+}
+
+// apiServiceReader reads pods and images from rkt's api-service, in the same
+// format as rkt.
+type apiServiceReader struct {
+	client rktapi.PublicAPIClient
+}
+
+// NewAPIServiceReader returns a Reader reading pods and images from the rkt
+// api-service listening on the given address, e.g. "localhost:15441".
+func NewAPIServiceReader(address string) (Reader, error) {
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the rkt api-service at %q: %v", address, err)
+	}
+	return &apiServiceReader{client: rktapi.NewPublicAPIClient(conn)}, nil
+}
+
+func (r *apiServiceReader) ListPods(ctx context.Context) ([]rkt.Pod, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiServiceTimeout)
+	defer cancel()
+
+	resp, err := r.client.ListPods(ctx, &rktapi.ListPodsRequest{Detail: true})
+	if err != nil {
+		return nil, apiServiceError(err, "list")
+	}
+
+	pods := make([]rkt.Pod, 0, len(resp.Pods))
+	for _, p := range resp.Pods {
+		pod, err := fromAPIPod(p)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, *pod)
+	}
+	return pods, nil
+}
+
+func (r *apiServiceReader) InspectPod(ctx context.Context, uuid string) (*rkt.Pod, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiServiceTimeout)
+	defer cancel()
+
+	resp, err := r.client.InspectPod(ctx, &rktapi.InspectPodRequest{Id: uuid})
+	if err != nil {
+		return nil, apiServiceError(err, "status", uuid)
+	}
+	return fromAPIPod(resp.Pod)
+}
+
+func (r *apiServiceReader) InspectApp(ctx context.Context, uuid, appName string) (*rkt.App, error) {
+	pod, err := r.InspectPod(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range pod.Apps {
+		if app.Name == appName {
+			return app, nil
+		}
+	}
+	return nil, &Error{Kind: ErrNotFound, SubCmd: "app", Args: []string{"status", uuid, "--app=" + appName}, Err: fmt.Errorf("app %q not found in pod %q", appName, uuid)}
+}
+
+func (r *apiServiceReader) ListImages(ctx context.Context) ([]rkt.ImageListEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiServiceTimeout)
+	defer cancel()
+
+	resp, err := r.client.ListImages(ctx, &rktapi.ListImagesRequest{})
+	if err != nil {
+		return nil, apiServiceError(err, "image", "list")
+	}
+
+	images := make([]rkt.ImageListEntry, 0, len(resp.Images))
+	for _, img := range resp.Images {
+		name := img.Name
+		if img.Version != "" {
+			name += ":" + img.Version
+		}
+		images = append(images, rkt.ImageListEntry{
+			ID:         img.Id,
+			Name:       name,
+			ImportTime: img.ImportTimestamp * int64(time.Second),
+			Size:       img.Size,
+		})
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].ImportTime < images[j].ImportTime })
+	return images, nil
+}
+
+func (r *apiServiceReader) InspectImage(ctx context.Context, id string) (*appcschema.ImageManifest, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiServiceTimeout)
+	defer cancel()
+
+	resp, err := r.client.InspectImage(ctx, &rktapi.InspectImageRequest{Id: id})
+	if err != nil {
+		rktErr := apiServiceError(err, "image", "cat-manifest", id)
+		if rktErr.Kind == ErrNotFound {
+			rktErr.Kind = ErrImageNotFound
+		}
+		return nil, rktErr
+	}
+	var manifest appcschema.ImageManifest
+	if err := json.Unmarshal(resp.Image.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the manifest of image %q: %v", id, err)
+	}
+	return &manifest, nil
+}
+
+// apiServiceError returns the error of an api-service call as the error of
+// the equivalent rkt command, keeping its kind.
+func apiServiceError(err error, subCmd string, args ...string) *Error {
+	glog.Warningf("rkt: api-service call for %v %v errored with %v", subCmd, args, err)
+	return &Error{Kind: GetErrorKind(err), SubCmd: subCmd, Args: args, Err: err}
+}
+
+// fromAPIPod converts a pod returned by the api-service, with its manifest,
+// to the format of `rkt status`. The api-service doesn't return the times of
+// the apps, nor whether they were created but not started yet.
+func fromAPIPod(p *rktapi.Pod) (*rkt.Pod, error) {
+	pod := &rkt.Pod{
+		UUID:  p.Id,
+		State: apiPodStates[p.State],
+	}
+	if pod.State == "" {
+		pod.State = "unknown"
+	}
+	if p.CreatedAt != 0 {
+		createdAt := p.CreatedAt
+		pod.CreatedAt = &createdAt
+	}
+	if p.StartedAt != 0 {
+		startedAt := p.StartedAt
+		pod.StartedAt = &startedAt
+	}
+	for _, n := range p.Networks {
+		pod.Networks = append(pod.Networks, netinfo.NetInfo{NetName: n.Name, IP: net.ParseIP(n.Ipv4)})
+	}
+
+	var manifest appcschema.PodManifest
+	if len(p.Manifest) != 0 {
+		if err := json.Unmarshal(p.Manifest, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the manifest of pod %q: %v", p.Id, err)
+		}
+	}
+	if len(manifest.UserAnnotations) > 0 {
+		pod.UserAnnotations = manifest.UserAnnotations
+	}
+	if len(manifest.UserLabels) > 0 {
+		pod.UserLabels = manifest.UserLabels
+	}
+
+	for _, a := range p.Apps {
+		app := &rkt.App{
+			Name:  a.Name,
+			State: rkt.AppStateUnknown,
+		}
+		if a.Image != nil {
+			app.ImageID = a.Image.Id
+		}
+		switch a.State {
+		case rktapi.AppState_APP_STATE_RUNNING:
+			app.State = rkt.AppStateRunning
+		case rktapi.AppState_APP_STATE_EXITED:
+			exitCode := a.ExitCode
+			app.State = rkt.AppStateExited
+			app.ExitCode = &exitCode
+		}
+		if name, err := appctypes.NewACName(a.Name); err != nil {
+			return nil, fmt.Errorf("invalid name of app %q of pod %q: %v", a.Name, p.Id, err)
+		} else if ra := manifest.Apps.Get(*name); ra != nil {
+			if ra.App != nil {
+				app.UserAnnotations = ra.App.UserAnnotations
+				app.UserLabels = ra.App.UserLabels
+			}
+			app.Mounts = appMounts(ra, &manifest)
+		}
+		pod.AppNames = append(pod.AppNames, a.Name)
+		pod.Apps = append(pod.Apps, app)
+	}
+
+	return pod, nil
+}
+
+// appMounts returns the mounts of an app of a pod.
+func appMounts(ra *appcschema.RuntimeApp, manifest *appcschema.PodManifest) []*rkt.Mount {
+	volumes := make(map[appctypes.ACName]appctypes.Volume, len(manifest.Volumes))
+	for _, vol := range manifest.Volumes {
+		volumes[vol.Name] = vol
+	}
+
+	var mounts []*rkt.Mount
+	for _, mnt := range ra.Mounts {
+		vol := volumes[mnt.Volume]
+		if mnt.AppVolume != nil {
+			vol = *mnt.AppVolume
+		}
+		var readOnly bool
+		if vol.ReadOnly != nil {
+			readOnly = *vol.ReadOnly
+		}
+		mounts = append(mounts, &rkt.Mount{
+			Name:          mnt.Volume.String(),
+			ContainerPath: mnt.Path,
+			HostPath:      vol.Source,
+			ReadOnly:      readOnly,
+		})
+	}
+	return mounts
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	appcschema "github.com/appc/spec/schema"
+	appctypes "github.com/appc/spec/schema/types"
+	rktapi "github.com/coreos/rkt/api/v1alpha"
+	rkt "github.com/rkt/rkt/api/v1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// fakeAPIService serves fixed pods and images.
+type fakeAPIService struct {
+	pods   []*rktapi.Pod
+	images []*rktapi.Image
+}
+
+func (s *fakeAPIService) GetInfo(context.Context, *rktapi.GetInfoRequest) (*rktapi.GetInfoResponse, error) {
+	return &rktapi.GetInfoResponse{}, nil
+}
+
+func (s *fakeAPIService) ListPods(ctx context.Context, req *rktapi.ListPodsRequest) (*rktapi.ListPodsResponse, error) {
+	return &rktapi.ListPodsResponse{Pods: s.pods}, nil
+}
+
+func (s *fakeAPIService) InspectPod(ctx context.Context, req *rktapi.InspectPodRequest) (*rktapi.InspectPodResponse, error) {
+	for _, pod := range s.pods {
+		if pod.Id == req.Id {
+			return &rktapi.InspectPodResponse{Pod: pod}, nil
+		}
+	}
+	return nil, grpc.Errorf(codes.NotFound, "pod %q not found", req.Id)
+}
+
+func (s *fakeAPIService) ListImages(ctx context.Context, req *rktapi.ListImagesRequest) (*rktapi.ListImagesResponse, error) {
+	return &rktapi.ListImagesResponse{Images: s.images}, nil
+}
+
+func (s *fakeAPIService) InspectImage(ctx context.Context, req *rktapi.InspectImageRequest) (*rktapi.InspectImageResponse, error) {
+	for _, image := range s.images {
+		if image.Id == req.Id {
+			return &rktapi.InspectImageResponse{Image: image}, nil
+		}
+	}
+	return nil, grpc.Errorf(codes.NotFound, "image %q not found", req.Id)
+}
+
+func (s *fakeAPIService) ListenEvents(*rktapi.ListenEventsRequest, rktapi.PublicAPI_ListenEventsServer) error {
+	return errors.New("not implemented")
+}
+
+func (s *fakeAPIService) GetLogs(*rktapi.GetLogsRequest, rktapi.PublicAPI_GetLogsServer) error {
+	return errors.New("not implemented")
+}
+
+func TestAPIServiceReader(t *testing.T) {
+	manifest := appcschema.BlankPodManifest()
+	manifest.UserAnnotations = appctypes.UserAnnotations{"io.kubernetes.pod.name": "foo"}
+	manifest.Apps = appcschema.AppList{{
+		Name:  *appctypes.MustACName("0-foo"),
+		Image: appcschema.RuntimeImage{ID: *appctypes.NewHashSHA512([]byte("foo"))},
+		App:   &appctypes.App{Exec: []string{"/foo"}, User: "0", Group: "0", UserLabels: map[string]string{"app": "foo"}},
+	}}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("unable to marshal pod manifest: %v", err)
+	}
+
+	service := &fakeAPIService{
+		pods: []*rktapi.Pod{{
+			Id:        "1234",
+			State:     rktapi.PodState_POD_STATE_RUNNING,
+			CreatedAt: 100,
+			Networks:  []*rktapi.Network{{Name: "default", Ipv4: "10.1.2.3"}},
+			Apps: []*rktapi.App{{
+				Name:     "0-foo",
+				Image:    &rktapi.Image{Id: "sha512-foo"},
+				State:    rktapi.AppState_APP_STATE_EXITED,
+				ExitCode: 2,
+			}},
+			Manifest: manifestData,
+		}},
+		images: []*rktapi.Image{
+			{Id: "sha512-new", Name: "example.com/new", Version: "latest", ImportTimestamp: 20, Manifest: []byte(`{"acKind":"ImageManifest","acVersion":"0.8.10","name":"example.com/new"}`)},
+			{Id: "sha512-old", Name: "example.com/old", ImportTimestamp: 10},
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	rktapi.RegisterPublicAPIServer(server, service)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	r, err := NewAPIServiceReader(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	pods, err := r.ListPods(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if assert.Len(t, pods, 1) {
+		pod := pods[0]
+		assert.Equal(t, "1234", pod.UUID)
+		assert.Equal(t, "running", pod.State)
+		assert.Equal(t, int64(100), *pod.CreatedAt)
+		assert.Equal(t, "10.1.2.3", pod.Networks[0].IP.String())
+		assert.Equal(t, map[string]string{"io.kubernetes.pod.name": "foo"}, pod.UserAnnotations)
+		assert.Equal(t, []string{"0-foo"}, pod.AppNames)
+	}
+
+	app, err := r.InspectApp(ctx, "1234", "0-foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, rkt.AppStateExited, app.State)
+	assert.Equal(t, int32(2), *app.ExitCode)
+	assert.Equal(t, "sha512-foo", app.ImageID)
+	assert.Equal(t, map[string]string{"app": "foo"}, app.UserLabels)
+
+	_, err = r.InspectApp(ctx, "1234", "1-bar")
+	assert.True(t, IsErrorKind(err, ErrNotFound))
+	_, err = r.InspectPod(ctx, "5678")
+	assert.True(t, IsErrorKind(err, ErrNotFound))
+
+	images, err := r.ListImages(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, []rkt.ImageListEntry{
+		{ID: "sha512-old", Name: "example.com/old", ImportTime: 10e9},
+		{ID: "sha512-new", Name: "example.com/new:latest", ImportTime: 20e9},
+	}, images)
+
+	imageManifest, err := r.InspectImage(ctx, "sha512-new")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.com/new", imageManifest.Name.String())
+	}
+	_, err = r.InspectImage(ctx, "sha512-gone")
+	assert.True(t, IsErrorKind(err, ErrImageNotFound))
+}
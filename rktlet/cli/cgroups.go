@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+)
+
+// The cgroup drivers, as set with the --cgroup-driver flag of the kubelet.
+// They define the format of the cgroup parents of pods.
+const (
+	// CgroupDriverSystemd cgroup parents are paths of systemd slices, e.g.
+	// /kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod<uid>.slice
+	CgroupDriverSystemd = "systemd"
+	// CgroupDriverCgroupfs cgroup parents are paths relative to the root of
+	// the cgroup hierarchies, e.g. /kubepods/besteffort/pod<uid>
+	CgroupDriverCgroupfs = "cgroupfs"
+)
+
+// joinCgroupsScript writes the pid of the shell to each of its arguments up
+// to "--", i.e. the cgroup.procs files of the cgroups to join, then executes
+// the rest of its arguments. Executing keeps the pid, so the process is still
+// the main process of its unit for systemd.
+const joinCgroupsScript = `while [ "$1" != -- ]; do echo $$ > "$1" || exit 1; shift; done; shift; exec "$@"`
+
+// ValidateCgroupDriver returns an error if the given cgroup driver isn't
+// supported.
+func ValidateCgroupDriver(driver string) error {
+	switch driver {
+	case CgroupDriverSystemd, CgroupDriverCgroupfs:
+		return nil
+	}
+	return fmt.Errorf("unsupported cgroup driver %q, must be %q or %q", driver, CgroupDriverSystemd, CgroupDriverCgroupfs)
+}
+
+// cgroupfsCommand returns a command running the given one in the cgroup
+// parent of a pod, in every cgroup hierarchy. The cgroups missing in some
+// hierarchies are created.
+//
+// That includes the hierarchy of systemd, where the stage1 reads its cgroup
+// from to place the apps in every hierarchy, so the command can't run in a
+// unit of systemd.
+func cgroupfsCommand(cgroupParent string, command []string) ([]string, error) {
+	cgroupParent = path.Clean("/" + cgroupParent)
+
+	hierarchies, err := cgroupHierarchies()
+	if err != nil {
+		return nil, err
+	}
+
+	joinCmd := []string{"/bin/sh", "-c", joinCgroupsScript, "sh"}
+	for _, hierarchy := range hierarchies {
+		dir := filepath.Join(hierarchy, cgroupParent)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create cgroup %q: %v", dir, err)
+		}
+		joinCmd = append(joinCmd, filepath.Join(dir, "cgroup.procs"))
+	}
+	joinCmd = append(joinCmd, "--")
+	return append(joinCmd, command...), nil
+}
+
+// cgroupHierarchies returns the directories of the cgroup hierarchies. With
+// the unified hierarchy of cgroup v2, that's the root directory. In hybrid
+// mode, the unified hierarchy only used by systemd is left out.
+func cgroupHierarchies() ([]string, error) {
+	if _, err := os.Stat(filepath.Join(util.CgroupRoot, "cgroup.controllers")); err == nil {
+		return []string{util.CgroupRoot}, nil
+	}
+
+	entries, err := ioutil.ReadDir(util.CgroupRoot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list cgroup hierarchies: %v", err)
+	}
+	var hierarchies []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Name() == "unified" {
+			continue
+		}
+		// Hierarchies with several controllers are linked from the name of
+		// each controller, e.g. cpu -> cpu,cpuacct.
+		dir, err := filepath.EvalSymlinks(filepath.Join(util.CgroupRoot, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		hierarchies = append(hierarchies, dir)
+	}
+	if len(hierarchies) == 0 {
+		return nil, fmt.Errorf("no cgroup hierarchy found in %s", util.CgroupRoot)
+	}
+	return hierarchies, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupfsCommand(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_cgroups")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = tmpDir
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	for _, dir := range []string{"memory", "cpu,cpuacct", "systemd", "unified"} {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("unable to create %q: %v", dir, err)
+		}
+	}
+	for _, link := range []string{"cpu", "cpuacct"} {
+		if err := os.Symlink("cpu,cpuacct", filepath.Join(tmpDir, link)); err != nil {
+			t.Fatalf("unable to create %q: %v", link, err)
+		}
+	}
+
+	// The cgroup parent is joined in the hierarchy of systemd too, where the
+	// stage1 reads the cgroup to place the apps in from.
+	cmd, err := cgroupfsCommand("/kubepods/besteffort/pod1234", []string{"echo", "running"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	procsFiles := []string{
+		filepath.Join(tmpDir, "cpu,cpuacct", "kubepods", "besteffort", "pod1234", "cgroup.procs"),
+		filepath.Join(tmpDir, "memory", "kubepods", "besteffort", "pod1234", "cgroup.procs"),
+		filepath.Join(tmpDir, "systemd", "kubepods", "besteffort", "pod1234", "cgroup.procs"),
+	}
+	assert.Equal(t, append(append([]string{"/bin/sh", "-c", joinCgroupsScript, "sh"}, procsFiles...), "--", "echo", "running"), cmd)
+
+	// The command joins the cgroups and keeps its pid.
+	c := exec.Command(cmd[0], cmd[1:]...)
+	out, err := c.Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "running\n", string(out))
+	for _, procsFile := range procsFiles {
+		pid, err := ioutil.ReadFile(procsFile)
+		if err != nil {
+			t.Fatalf("unable to read %q: %v", procsFile, err)
+		}
+		assert.Equal(t, strconv.Itoa(c.ProcessState.Pid()), strings.TrimSpace(string(pid)))
+	}
+	_, err = os.Stat(filepath.Join(tmpDir, "unified", "kubepods"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCgroupfsCommandUnified(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_cgroups")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = tmpDir
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "cgroup.controllers"), []byte("cpu memory\n"), 0644); err != nil {
+		t.Fatalf("unable to create cgroup.controllers: %v", err)
+	}
+
+	cmd, err := cgroupfsCommand("/kubepods/besteffort/pod1234", []string{"rkt"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", joinCgroupsScript, "sh", filepath.Join(tmpDir, "kubepods", "besteffort", "pod1234", "cgroup.procs"), "--", "rkt"}, cmd)
+}
+
+func TestValidateCgroupDriver(t *testing.T) {
+	assert.NoError(t, ValidateCgroupDriver(CgroupDriverSystemd))
+	assert.NoError(t, ValidateCgroupDriver(CgroupDriverCgroupfs))
+	assert.Error(t, ValidateCgroupDriver("none"))
+}
@@ -20,11 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"reflect"
 	"strings"
 
 	"github.com/golang/glog"
-	utilexec "k8s.io/utils/exec"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -128,7 +129,6 @@ func (cfg *CLIConfig) Merge(newCfg CLIConfig) {
 type cli struct {
 	rktPath string
 	config  CLIConfig
-	execer  utilexec.Interface
 
 	globalFlags []string
 }
@@ -138,20 +138,27 @@ func (c *cli) With(cfg CLIConfig) CLI {
 
 	copyCfg.Merge(cfg)
 
-	return NewRktCLI(c.rktPath, c.execer, copyCfg)
+	return NewRktCLI(c.rktPath, copyCfg)
 }
 
 // RunCommand execute a rkt command with the given subCmd and args.
 func (c *cli) RunCommand(subCmd string, args ...string) ([]string, error) {
+	return c.RunCommandContext(context.Background(), subCmd, args...)
+}
+
+// RunCommandContext executes a rkt command like RunCommand, but kills rkt if
+// the context is done before the command completes.
+func (c *cli) RunCommandContext(ctx context.Context, subCmd string, args ...string) ([]string, error) {
 	command := c.Command(subCmd, args...)
 	glog.V(4).Infof("rkt: calling cmd %v", command)
-	cmd := c.execer.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 
 	out, err := cmd.CombinedOutput()
 	output := string(out)
 	if err != nil {
-		glog.Warningf("rkt: cmd %v %v errored with %v, %q", subCmd, args, err, output)
-		return nil, fmt.Errorf("failed to run %v %v: %v\noutput: %s", subCmd, args, err, output)
+		rktErr := newError(ctx, subCmd, args, output, err)
+		glog.Warningf("rkt: cmd %v %v errored with %v (%v), %q", subCmd, args, rktErr.Err, rktErr.Kind, output)
+		return nil, rktErr
 	}
 
 	return strings.Split(strings.TrimSpace(output), "\n"), nil
@@ -163,8 +170,7 @@ func (c *cli) Command(subCmd string, args ...string) []string {
 	return append(append([]string{c.rktPath, subCmd}, c.globalFlags...), args...)
 }
 
-// TODO(tmrts): implement CLI with timeout
-func NewRktCLI(rktPath string, exec utilexec.Interface, cfg CLIConfig) CLI {
+func NewRktCLI(rktPath string, cfg CLIConfig) CLI {
 	// this can be removed once 'app' is stable in rkt
 	if err := os.Setenv("RKT_EXPERIMENT_APP", "true"); err != nil {
 		panic(err)
@@ -172,5 +178,5 @@ func NewRktCLI(rktPath string, exec utilexec.Interface, cfg CLIConfig) CLI {
 	if err := os.Setenv("RKT_EXPERIMENT_ATTACH", "true"); err != nil {
 		panic(err)
 	}
-	return &cli{rktPath: rktPath, config: cfg, execer: exec, globalFlags: getFlagFormOfStruct(cfg)}
+	return &cli{rktPath: rktPath, config: cfg, globalFlags: getFlagFormOfStruct(cfg)}
 }
@@ -18,9 +18,14 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 )
 
 func TestGetFlagFormOfStruct(t *testing.T) {
@@ -59,3 +64,31 @@ func TestGetFlagFormOfStruct(t *testing.T) {
 	}
 
 }
+
+func TestRunCommandContext(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_cli")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A fake rkt sleeping for as many seconds as its subcommand says.
+	rktPath := filepath.Join(tmpDir, "rkt")
+	if err := ioutil.WriteFile(rktPath, []byte("#!/bin/sh\nexec sleep \"$1\"\n"), 0755); err != nil {
+		t.Fatalf("unable to write fake rkt: %v", err)
+	}
+	c := NewRktCLI(rktPath, CLIConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.RunCommandContext(ctx, "10")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	}
+	assert.True(t, time.Since(start) < 5*time.Second, "the command wasn't killed")
+
+	output, err := c.RunCommandContext(context.Background(), "0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, output)
+}
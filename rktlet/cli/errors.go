@@ -16,26 +16,223 @@ limitations under the License.
 
 package cli
 
-import "regexp"
+import (
+	"fmt"
+	"os"
+	"regexp"
 
-// pod "379ae074-f1ca-4bdc-8493-e7278b00009f" is already stopped
-var alreadyStoppedRegex = regexp.MustCompile(`pod "[^"]+" is already stopped`)
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKind classifies the failures of rkt commands.
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	// ErrNotFound is returned when the pod or app doesn't exist.
+	ErrNotFound
+	// ErrAlreadyExists is returned when adding an app with the name of an
+	// existing one.
+	ErrAlreadyExists
+	// ErrAlreadyStopped is returned when stopping a pod or app which isn't
+	// running.
+	ErrAlreadyStopped
+	// ErrImageNotFound is returned when an image is neither in the store nor
+	// in its registry.
+	ErrImageNotFound
+	// ErrLockContention is returned when another rkt process holds a lock the
+	// command needs, e.g. during garbage collection.
+	ErrLockContention
+	// ErrPermissionDenied is returned when rkt lacks privileges.
+	ErrPermissionDenied
+	// ErrTimeout is returned when the command didn't complete in time.
+	ErrTimeout
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnknown:          "unknown",
+	ErrNotFound:         "not found",
+	ErrAlreadyExists:    "already exists",
+	ErrAlreadyStopped:   "already stopped",
+	ErrImageNotFound:    "image not found",
+	ErrLockContention:   "lock contention",
+	ErrPermissionDenied: "permission denied",
+	ErrTimeout:          "timeout",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+// errorPatterns match the output of rkt for each kind of error. They are
+// tried in order, so more specific patterns come first.
+var errorPatterns = []struct {
+	kind  ErrorKind
+	regex *regexp.Regexp
+}{
+	// pod "379ae074-f1ca-4bdc-8493-e7278b00009f" is already stopped
+	{ErrAlreadyStopped, regexp.MustCompile(`(pod|app) "[^"]+" is (already stopped|not running)`)},
+	{ErrImageNotFound, regexp.MustCompile(`(?i)no image(s)?( IDs)? found|cannot find image|image .*not found|manifest unknown|status code 404`)},
+	// stop: cannot get pod: no matches found for "37edaae0-f048-4db5-b3fb-c0de3aa8e9d8"
+	{ErrNotFound, regexp.MustCompile(`no matches found for "[^"]+"|(pod|app) "[^"]*" not found|cannot find app`)},
+	// app add: error adding app: app "0-foo" already exists
+	{ErrAlreadyExists, regexp.MustCompile(`app "[^"]+" already exists|multiple apps with name`)},
+	{ErrLockContention, regexp.MustCompile(`(?i)already locked|cannot acquire( the)? lock|resource temporarily unavailable|database is locked|lock contention`)},
+	{ErrPermissionDenied, regexp.MustCompile(`(?i)permission denied|operation not permitted|must be run as root`)},
+	// status: timed out waiting for pod to be ready
+	{ErrTimeout, regexp.MustCompile(`timed out waiting for (the )?pod|context deadline exceeded`)},
+}
+
+// Error is the error of a rkt command that failed.
+type Error struct {
+	Kind   ErrorKind
+	SubCmd string
+	Args   []string
+	// Output is the combined stdout and stderr of rkt.
+	Output string
+	Err    error
+	// Retries is how many times the command was retried before giving up.
+	Retries int
+}
+
+func (e *Error) Error() string {
+	if e.Retries > 0 {
+		return fmt.Sprintf("failed to run %v %v after %d retries: %v\noutput: %s", e.SubCmd, e.Args, e.Retries, e.Err, e.Output)
+	}
+	return fmt.Sprintf("failed to run %v %v: %v\noutput: %s", e.SubCmd, e.Args, e.Err, e.Output)
+}
+
+// newError classifies the failure of a rkt command from its output.
+func newError(ctx context.Context, subCmd string, args []string, output string, err error) *Error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// rkt was killed, report why.
+		kind := ErrTimeout
+		if ctxErr == context.Canceled {
+			kind = ErrUnknown
+		}
+		return &Error{Kind: kind, SubCmd: subCmd, Args: args, Output: output, Err: ctxErr}
+	}
+	return &Error{Kind: classifyOutput(output), SubCmd: subCmd, Args: args, Output: output, Err: err}
+}
+
+func classifyOutput(output string) ErrorKind {
+	for _, pattern := range errorPatterns {
+		if pattern.regex.MatchString(output) {
+			return pattern.kind
+		}
+	}
+	return ErrUnknown
+}
+
+// wrappedError prefixes the message of an error with some context, and keeps
+// the error as its cause.
+type wrappedError struct {
+	msg   string
+	cause error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg + ": " + e.cause.Error()
+}
+
+// Cause returns the wrapped error.
+func (e *wrappedError) Cause() error {
+	return e.cause
+}
+
+// WrapError returns an error whose message is the formatted message followed
+// by the message of err, and which keeps the kind of err.
+func WrapError(err error, format string, args ...interface{}) error {
+	return &wrappedError{msg: fmt.Sprintf(format, args...), cause: err}
+}
+
+// cause returns the error wrapped by err with WrapError, if any, recursively.
+func cause(err error) error {
+	for {
+		wrapped, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return err
+		}
+		err = wrapped.Cause()
+	}
+}
+
+// GetErrorKind returns the kind of an error of a rkt command, or of an error
+// wrapping it with WrapError. Missing files, e.g. those of a pod which isn't
+// running, are of kind ErrNotFound, and expired contexts of kind ErrTimeout.
+// Other errors are of kind ErrUnknown, whatever their message.
+func GetErrorKind(err error) ErrorKind {
+	err = cause(err)
+	switch e := err.(type) {
+	case nil:
+		return ErrUnknown
+	case *Error:
+		return e.Kind
+	}
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	// The errors of the rkt api-service have a gRPC code instead.
+	switch grpc.Code(err) {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.PermissionDenied:
+		return ErrPermissionDenied
+	case codes.DeadlineExceeded:
+		return ErrTimeout
+	}
+	return ErrUnknown
+}
+
+// IsErrorKind returns whether err is an error of a rkt command of the given
+// kind.
+func IsErrorKind(err error, kind ErrorKind) bool {
+	return err != nil && GetErrorKind(err) == kind
+}
 
 // RktStopIsNotExistError determines if an error resulting from running `rkt
 // stop` or `rkt app stop` is the result of the pod already being stopped
 func RktStopIsAlreadyStoppedError(err error) bool {
-	if err == nil {
-		return false
-	}
-	return alreadyStoppedRegex.MatchString(err.Error())
+	return IsErrorKind(err, ErrAlreadyStopped)
 }
 
-// stop: cannot get pod: no matches found for "37edaae0-f048-4db5-b3fb-c0de3aa8e9d8"
-var isNotExistStopError = regexp.MustCompile(`stop: cannot get pod: no matches found for "[^"]+"`)
-
 func RktStopIsNotExistError(err error) bool {
+	return IsErrorKind(err, ErrNotFound)
+}
+
+var errorKindCodes = map[ErrorKind]codes.Code{
+	ErrNotFound:         codes.NotFound,
+	ErrAlreadyExists:    codes.AlreadyExists,
+	ErrAlreadyStopped:   codes.FailedPrecondition,
+	ErrImageNotFound:    codes.NotFound,
+	ErrLockContention:   codes.Unavailable,
+	ErrPermissionDenied: codes.PermissionDenied,
+	ErrTimeout:          codes.DeadlineExceeded,
+}
+
+// GRPCError returns an error with the gRPC status code matching the kind of
+// the given error. Errors which already have a code are returned as is.
+func GRPCError(err error) error {
 	if err == nil {
-		return false
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if cause(err) == context.Canceled {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	code, ok := errorKindCodes[GetErrorKind(err)]
+	if !ok {
+		code = codes.Unknown
 	}
-	return isNotExistStopError.MatchString(err.Error())
+	return status.Error(code, err.Error())
 }
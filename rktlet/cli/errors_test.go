@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"os"
+)
+
+func TestErrorKind(t *testing.T) {
+	testCases := []struct {
+		output string
+		kind   ErrorKind
+		code   codes.Code
+	}{
+		{`stop: pod "379ae074-f1ca-4bdc-8493-e7278b00009f" is already stopped`, ErrAlreadyStopped, codes.FailedPrecondition},
+		{`stop: cannot get pod: no matches found for "37edaae0-f048-4db5-b3fb-c0de3aa8e9d8"`, ErrNotFound, codes.NotFound},
+		{`app add: error adding app: app "0-foo" already exists`, ErrAlreadyExists, codes.AlreadyExists},
+		{`image rm: no image IDs found`, ErrImageNotFound, codes.NotFound},
+		{`fetch: registry returned status code 404`, ErrImageNotFound, codes.NotFound},
+		{`gc: cannot acquire lock: file already locked`, ErrLockContention, codes.Unavailable},
+		{`list: open /var/lib/rkt/pods: permission denied`, ErrPermissionDenied, codes.PermissionDenied},
+		{`status: timed out waiting for pod to be ready`, ErrTimeout, codes.DeadlineExceeded},
+		{`run: something else went wrong`, ErrUnknown, codes.Unknown},
+		// Paths and arguments matching the words of rkt's messages.
+		{`app add: open /var/lib/timeout/config.json: no such file or directory`, ErrUnknown, codes.Unknown},
+		{`run: mkdir /opt/already exists: file exists`, ErrUnknown, codes.Unknown},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.kind.String(), func(t *testing.T) {
+			err := newError(context.Background(), "foo", nil, testCase.output, errors.New("exit status 254"))
+			assert.Equal(t, testCase.kind, GetErrorKind(err))
+			assert.Equal(t, testCase.code, grpc.Code(GRPCError(err)))
+
+			// Wrapping the error keeps its kind.
+			wrapped := WrapError(err, "unable to do %s", "foo")
+			assert.Equal(t, "unable to do foo: "+err.Error(), wrapped.Error())
+			assert.Equal(t, testCase.kind, GetErrorKind(wrapped))
+			assert.Equal(t, testCase.code, grpc.Code(GRPCError(wrapped)))
+
+			// Other errors aren't classified from their message.
+			other := fmt.Errorf("unable to do foo: %v", err)
+			assert.Equal(t, ErrUnknown, GetErrorKind(other))
+			assert.Equal(t, codes.Unknown, grpc.Code(GRPCError(other)))
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	err := newError(ctx, "fetch", nil, "", errors.New("signal: killed"))
+	assert.Equal(t, ErrTimeout, GetErrorKind(err))
+	assert.Equal(t, codes.DeadlineExceeded, grpc.Code(GRPCError(err)))
+
+	// Missing files and context errors are classified even when wrapped.
+	_, openErr := os.Open("/nonexistent")
+	assert.Equal(t, codes.NotFound, grpc.Code(GRPCError(WrapError(openErr, "unable to read status"))))
+	assert.Equal(t, codes.DeadlineExceeded, grpc.Code(GRPCError(WrapError(context.DeadlineExceeded, "unable to list"))))
+	assert.Equal(t, codes.Canceled, grpc.Code(GRPCError(WrapError(context.Canceled, "unable to list"))))
+
+	assert.Nil(t, GRPCError(nil))
+}
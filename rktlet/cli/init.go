@@ -18,22 +18,65 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 	utilexec "k8s.io/utils/exec"
 )
 
+// systemdRuntimeDir only exists when the host was booted with systemd, see
+// sd_booted(3).
+var systemdRuntimeDir = "/run/systemd/system"
+
+// SystemdBooted returns whether the host was booted with systemd.
+func SystemdBooted() bool {
+	_, err := os.Stat(systemdRuntimeDir)
+	return err == nil
+}
+
+// logLines is how many of the last log lines of a failed process are
+// reported.
+const logLines = 20
+
+// SystemdConfig configures how the Inits using systemd run processes.
+type SystemdConfig struct {
+	// ReadyTimeout is how long a process has to notify it's ready before it's
+	// killed. If it's 0, the default timeout of systemd applies.
+	ReadyTimeout time.Duration
+}
+
 type systemd struct {
+	SystemdConfig
 	systemdRunPath string
+	systemctlPath  string
 	execer         utilexec.Interface
 }
 
-// NewSystemd creates an Init object with the path to `systemd-run`.
-func NewSystemd(systemdRunPath string, execer utilexec.Interface) Init {
-	return &systemd{systemdRunPath, execer}
+// NewSystemd creates an Init object with the paths to `systemd-run` and
+// `systemctl`.
+func NewSystemd(systemdRunPath, systemctlPath string, cfg SystemdConfig, execer utilexec.Interface) Init {
+	return &systemd{cfg, systemdRunPath, systemctlPath, execer}
+}
+
+// placement returns the slice in which to run a command for a pod with the
+// given cgroup parent, and the command to run. Only the cgroup parents of the
+// systemd driver can be used: systemd keeps the processes of its units in
+// its own slices in its hierarchy, which the stage1 places the apps with.
+func (cfg SystemdConfig) placement(cgroupParent string, command []string) (string, []string, error) {
+	if cgroupParent == "" {
+		return "", command, nil
+	}
+	// If cgroupParent doesn't exist in some of the subsystems,
+	// it will be created (e.g. systemd, memeory, cpu). Otherwise
+	// the process will be put inside them.
+	slice, err := cgroupParentToSliceName(cgroupParent)
+	return slice, command, err
 }
 
 // cgroupParentToSliceName converts a cgroup path such as:
@@ -48,13 +91,14 @@ func NewSystemd(systemdRunPath string, execer utilexec.Interface) Init {
 //
 // The Kubelet must be started with --cgroup-driver=systemd
 // (CGROUP_DRIVER=systemd in hack/local-up-cluster.sh), otherwise the
-// cgroupParent will not be convertible.
+// cgroupParent will not be convertible and rktlet must be started with
+// --cgroup-driver=cgroupfs and --init=process instead.
 func cgroupParentToSliceName(cgroupParent string) (string, error) {
 	// Example for podBase: "kubepods-besteffort-pod5c5979ec_9871_11e7_b58f_c85b763781a4.slice"
 	podBase := path.Base(cgroupParent)
 
 	if !strings.HasSuffix(podBase, ".slice") {
-		return "", fmt.Errorf("cgroup %q not convertible to slice name: please start the Kubelet with --cgroup-driver=systemd", cgroupParent)
+		return "", fmt.Errorf("cgroup %q not convertible to slice name: please start the Kubelet with --cgroup-driver=systemd, or rktlet with --cgroup-driver=cgroupfs --init=process", cgroupParent)
 	}
 
 	return podBase, nil
@@ -62,23 +106,27 @@ func cgroupParentToSliceName(cgroupParent string) (string, error) {
 
 // StartProcess runs the 'command + args' as a child of the init process,
 // and returns the id of the process.
+//
+// The process runs in a unit of type notify, so systemd-run only returns
+// once it notified systemd it's ready, see sd_notify(3). The stage1 of rkt
+// does so once the pod is running. If the process fails or times out
+// instead, the error includes its exit status and last log lines.
 func (s *systemd) StartProcess(cgroupParent, command string, args ...string) (id string, err error) {
 	unitName := fmt.Sprintf("rktlet-%s", uuid.New())
 
 	cmdList := []string{s.systemdRunPath, "--unit=" + unitName, "--setenv=RKT_EXPERIMENT_APP=true", "--setenv=RKT_EXPERIMENT_ATTACH=true", "--service-type=notify"}
-	if cgroupParent != "" {
-		// If cgroupParent doesn't exist in some of the subsystems,
-		// it will be created (e.g. systemd, memeory, cpu). Otherwise
-		// the process will be put inside them.
-		slice, err := cgroupParentToSliceName(cgroupParent)
-		if err != nil {
-			glog.Warningf("%v", err)
-			return "", err
-		}
+	if s.ReadyTimeout > 0 {
+		cmdList = append(cmdList, fmt.Sprintf("--property=TimeoutStartSec=%dms", s.ReadyTimeout/time.Millisecond))
+	}
+	slice, sandboxCmd, err := s.placement(cgroupParent, append([]string{command}, args...))
+	if err != nil {
+		glog.Warningf("%v", err)
+		return "", err
+	}
+	if slice != "" {
 		cmdList = append(cmdList, "--slice="+slice)
 	}
-	cmdList = append(cmdList, command)
-	cmdList = append(cmdList, args...)
+	cmdList = append(cmdList, sandboxCmd...)
 
 	glog.V(4).Infof("Running %s", strings.Join(cmdList, " "))
 
@@ -86,7 +134,155 @@ func (s *systemd) StartProcess(cgroupParent, command string, args ...string) (id
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		glog.Warningf("rkt: %v errored with %v", cmdList, err)
-		return "", fmt.Errorf("failed to run systemd-run %v %v: %v\noutput: %s", command, args, err, out)
+		err = fmt.Errorf("failed to run systemd-run %v %v: %v\noutput: %s%s", command, args, err, out, s.unitFailure(unitName))
+		if stopErr := s.StopProcess(context.Background(), unitName); stopErr != nil {
+			glog.Warningf("rkt: unable to clean up unit %q: %v", unitName, stopErr)
+		}
+		return "", err
 	}
 	return unitName, nil
 }
+
+// unitFailure describes why a unit failed to start, from its status and its
+// last log lines in the journal.
+func (s *systemd) unitFailure(unitName string) string {
+	var failure string
+	if status, err := s.ProcessStatus(unitName); err != nil {
+		glog.Warningf("rkt: unable to get status of unit %q: %v", unitName, err)
+	} else if !status.Running {
+		failure += fmt.Sprintf("\nunit %s failed (%s) with exit code %d", unitName, status.Reason, status.ExitCode)
+	}
+	if logs := unitLogs(s.execer, unitName); logs != "" {
+		failure += fmt.Sprintf("\nlast logs of unit %s:\n%s", unitName, logs)
+	}
+	return failure
+}
+
+// unitLogs returns the last log lines of a unit in the journal, or an empty
+// string if they can't be read.
+func unitLogs(execer utilexec.Interface, unitName string) string {
+	journalctlPath, err := execer.LookPath("journalctl")
+	if err != nil {
+		return ""
+	}
+	logs, err := execer.Command(journalctlPath, "--unit="+unitName, "--lines="+strconv.Itoa(logLines), "--no-pager", "--output=cat").CombinedOutput()
+	if err != nil {
+		glog.Warningf("rkt: unable to get logs of unit %q: %v\noutput: %s", unitName, err, logs)
+		return ""
+	}
+	return string(logs)
+}
+
+// StopProcess stops the transient unit with the given name, and resets it
+// if it failed so it doesn't linger in `systemctl list-units`. systemctl
+// waits for the unit to stop, whether the context is done or not, but
+// systemd kills the unit once its stop timeout expires.
+func (s *systemd) StopProcess(ctx context.Context, unitName string) error {
+	if err := s.systemctl("stop", unitName); err != nil {
+		return err
+	}
+	return s.systemctl("reset-failed", unitName)
+}
+
+// RemoveProcess is a no-op: the unit was reset when it was stopped, and its
+// logs are kept in the journal.
+func (s *systemd) RemoveProcess(unitName string) error {
+	return nil
+}
+
+// ProcessLogs returns the last log lines of the unit with the given name in
+// the journal.
+func (s *systemd) ProcessLogs(unitName string) string {
+	return unitLogs(s.execer, unitName)
+}
+
+// systemctl runs a systemctl command on a unit, ignoring the errors caused
+// by the unit not being loaded, e.g. because it's inactive and not failed.
+func (s *systemd) systemctl(command, unitName string) error {
+	out, err := s.execer.Command(s.systemctlPath, command, unitName).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "not loaded") {
+			glog.V(4).Infof("rkt: unit %q not loaded, ignoring systemctl %s", unitName, command)
+			return nil
+		}
+		return fmt.Errorf("failed to run systemctl %s %s: %v\noutput: %s", command, unitName, err, out)
+	}
+	return nil
+}
+
+// The values of ExecMainCode, see waitid(2).
+const (
+	cldExited = "1"
+	cldKilled = "2"
+	cldDumped = "3"
+)
+
+// ProcessStatus returns the status of the transient unit with the given
+// name.
+func (s *systemd) ProcessStatus(unitName string) (*ProcessStatus, error) {
+	out, err := s.execer.Command(s.systemctlPath, "show", unitName,
+		"--property=LoadState",
+		"--property=ActiveState",
+		"--property=Result",
+		"--property=ExecMainCode",
+		"--property=ExecMainStatus",
+	).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run systemctl show %s: %v\noutput: %s", unitName, err, out)
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			props[kv[0]] = kv[1]
+		}
+	}
+	return unitStatus(unitName, props)
+}
+
+// unitStatus returns the status of a service unit from its LoadState,
+// ActiveState, Result, ExecMainCode and ExecMainStatus properties, as
+// formatted by `systemctl show`.
+func unitStatus(unitName string, props map[string]string) (*ProcessStatus, error) {
+	if props["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("unit %q not found", unitName)
+	}
+
+	status := &ProcessStatus{}
+	switch props["ActiveState"] {
+	case "active", "reloading":
+		// Units of type notify are only active once they notified they're
+		// ready.
+		status.Ready = true
+		fallthrough
+	case "activating", "deactivating":
+		status.Running = true
+		return status, nil
+	}
+	if result := props["Result"]; result != "success" {
+		status.Reason = result
+	}
+	switch props["ExecMainCode"] {
+	case cldExited:
+		var err error
+		status.ExitCode, err = strconv.Atoi(props["ExecMainStatus"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit status of unit %q: %v", unitName, err)
+		}
+	case cldKilled, cldDumped:
+		status.ExitCode = -1
+	}
+	return status, nil
+}
+
+// Ready checks that systemd-run can be run and that systemd is the init
+// system of the host.
+func (s *systemd) Ready() error {
+	if out, err := s.execer.Command(s.systemdRunPath, "--version").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %s: %v\noutput: %s", s.systemdRunPath, err, out)
+	}
+	if _, err := os.Stat(systemdRuntimeDir); err != nil {
+		return fmt.Errorf("systemd doesn't seem to be running: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/dbus"
+	"github.com/godbus/dbus"
+	"github.com/golang/glog"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// defaultStartTimeout is how long systemd waits for a unit to start,
+	// unless configured otherwise, see DefaultTimeoutStartSec in
+	// systemd-system.conf(5).
+	defaultStartTimeout = 90 * time.Second
+	// jobResultMargin is how long to wait for the result of a job after
+	// systemd should have timed it out, in case the result was lost.
+	jobResultMargin = 10 * time.Second
+
+	errNoSuchUnit = "org.freedesktop.systemd1.NoSuchUnit"
+)
+
+// systemdManager is the part of the D-Bus API of systemd used to run
+// processes. It's implemented by the connections of go-systemd.
+type systemdManager interface {
+	StartTransientUnit(name string, mode string, properties []sddbus.Property, ch chan<- string) (int, error)
+	StopUnit(name string, mode string, ch chan<- string) (int, error)
+	ResetFailedUnit(name string) error
+	GetUnitProperties(unit string) (map[string]interface{}, error)
+	GetUnitTypeProperties(unit string, unitType string) (map[string]interface{}, error)
+	GetManagerProperty(prop string) (string, error)
+	Close()
+}
+
+// reconnectingManager is a systemdManager connecting to systemd again when
+// its connection was closed, e.g. because the D-Bus daemon restarted.
+type reconnectingManager struct {
+	connect func() (systemdManager, error)
+
+	lock    sync.Mutex
+	manager systemdManager
+}
+
+func newReconnectingManager(connect func() (systemdManager, error)) (*reconnectingManager, error) {
+	manager, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	return &reconnectingManager{connect: connect, manager: manager}, nil
+}
+
+// do makes a call over the current connection, and makes it once more over a
+// new connection if the current one was closed.
+func (m *reconnectingManager) do(call func(manager systemdManager) error) error {
+	m.lock.Lock()
+	manager := m.manager
+	m.lock.Unlock()
+
+	err := call(manager)
+	if err != dbus.ErrClosed {
+		return err
+	}
+	if manager, err = m.reconnect(manager); err != nil {
+		return err
+	}
+	return call(manager)
+}
+
+// reconnect replaces the closed connection, unless another call already did.
+func (m *reconnectingManager) reconnect(closed systemdManager) (systemdManager, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.manager != closed {
+		return m.manager, nil
+	}
+	glog.Warningf("rkt: connection to systemd closed, reconnecting")
+	manager, err := m.connect()
+	if err != nil {
+		return nil, fmt.Errorf("unable to reconnect to systemd: %v", err)
+	}
+	closed.Close()
+	m.manager = manager
+	return manager, nil
+}
+
+func (m *reconnectingManager) StartTransientUnit(name string, mode string, properties []sddbus.Property, ch chan<- string) (jobID int, err error) {
+	err = m.do(func(manager systemdManager) error {
+		jobID, err = manager.StartTransientUnit(name, mode, properties, ch)
+		return err
+	})
+	return jobID, err
+}
+
+func (m *reconnectingManager) StopUnit(name string, mode string, ch chan<- string) (jobID int, err error) {
+	err = m.do(func(manager systemdManager) error {
+		jobID, err = manager.StopUnit(name, mode, ch)
+		return err
+	})
+	return jobID, err
+}
+
+func (m *reconnectingManager) ResetFailedUnit(name string) error {
+	return m.do(func(manager systemdManager) error {
+		return manager.ResetFailedUnit(name)
+	})
+}
+
+func (m *reconnectingManager) GetUnitProperties(unit string) (props map[string]interface{}, err error) {
+	err = m.do(func(manager systemdManager) error {
+		props, err = manager.GetUnitProperties(unit)
+		return err
+	})
+	return props, err
+}
+
+func (m *reconnectingManager) GetUnitTypeProperties(unit string, unitType string) (props map[string]interface{}, err error) {
+	err = m.do(func(manager systemdManager) error {
+		props, err = manager.GetUnitTypeProperties(unit, unitType)
+		return err
+	})
+	return props, err
+}
+
+func (m *reconnectingManager) GetManagerProperty(prop string) (value string, err error) {
+	err = m.do(func(manager systemdManager) error {
+		value, err = manager.GetManagerProperty(prop)
+		return err
+	})
+	return value, err
+}
+
+func (m *reconnectingManager) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.manager.Close()
+}
+
+// UnitStartError is returned when a transient unit fails to start.
+type UnitStartError struct {
+	Unit string
+	// JobResult is the result of the start job, e.g. "failed" or "timeout".
+	JobResult string
+	// Status is the status of the unit once it failed, if it's known.
+	Status *ProcessStatus
+	// Logs are the last log lines of the unit.
+	Logs string
+}
+
+func (e *UnitStartError) Error() string {
+	msg := fmt.Sprintf("unit %s failed to start: %s", e.Unit, e.JobResult)
+	if e.Status != nil && !e.Status.Running {
+		msg += fmt.Sprintf("\nunit %s failed (%s) with exit code %d", e.Unit, e.Status.Reason, e.Status.ExitCode)
+	}
+	if e.Logs != "" {
+		msg += fmt.Sprintf("\nlast logs of unit %s:\n%s", e.Unit, e.Logs)
+	}
+	return msg
+}
+
+type systemdDBus struct {
+	SystemdConfig
+	manager systemdManager
+	// execer runs journalctl to get the logs of the units failing to start.
+	execer utilexec.Interface
+}
+
+// NewSystemdDBus creates an Init object running processes in transient units
+// created over the D-Bus API of systemd. It connects to systemd again if the
+// connection gets closed.
+func NewSystemdDBus(cfg SystemdConfig, execer utilexec.Interface) (Init, error) {
+	manager, err := newReconnectingManager(func() (systemdManager, error) {
+		return sddbus.New()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to systemd: %v", err)
+	}
+	return &systemdDBus{cfg, manager, execer}, nil
+}
+
+// StartProcess runs the 'command + args' in a new transient unit of type
+// notify, and returns its name once the process notified systemd it's ready,
+// see sd_notify(3). The stage1 of rkt does so once the pod is running. If the
+// process fails or times out instead, a *UnitStartError is returned.
+func (s *systemdDBus) StartProcess(cgroupParent, command string, args ...string) (string, error) {
+	id := fmt.Sprintf("rktlet-%s", uuid.New())
+	unitName := id + ".service"
+
+	slice, sandboxCmd, err := s.placement(cgroupParent, append([]string{command}, args...))
+	if err != nil {
+		glog.Warningf("%v", err)
+		return "", err
+	}
+	props := []sddbus.Property{
+		sddbus.PropExecStart(sandboxCmd, false),
+		sddbus.PropType("notify"),
+		{Name: "Environment", Value: dbus.MakeVariant([]string{"RKT_EXPERIMENT_APP=true", "RKT_EXPERIMENT_ATTACH=true"})},
+	}
+	if slice != "" {
+		props = append(props, sddbus.PropSlice(slice))
+	}
+	timeout := defaultStartTimeout
+	if s.ReadyTimeout > 0 {
+		timeout = s.ReadyTimeout
+		props = append(props, sddbus.Property{Name: "TimeoutStartUSec", Value: dbus.MakeVariant(uint64(timeout / time.Microsecond))})
+	}
+
+	glog.V(4).Infof("rkt: starting unit %s running %s %v", unitName, command, args)
+
+	result := make(chan string, 1)
+	if _, err := s.manager.StartTransientUnit(unitName, "fail", props, result); err != nil {
+		return "", fmt.Errorf("failed to start unit %s: %v", unitName, err)
+	}
+	var jobResult string
+	select {
+	case jobResult = <-result:
+	case <-time.After(timeout + jobResultMargin):
+		jobResult = "timeout"
+	}
+	if jobResult == "done" {
+		return id, nil
+	}
+
+	startErr := &UnitStartError{Unit: unitName, JobResult: jobResult, Logs: unitLogs(s.execer, unitName)}
+	if status, statusErr := s.ProcessStatus(id); statusErr != nil {
+		glog.Warningf("rkt: unable to get status of unit %q: %v", unitName, statusErr)
+	} else {
+		startErr.Status = status
+	}
+	glog.Warningf("rkt: %v", startErr)
+	if stopErr := s.StopProcess(context.Background(), id); stopErr != nil {
+		glog.Warningf("rkt: unable to clean up unit %q: %v", unitName, stopErr)
+	}
+	return "", startErr
+}
+
+// StopProcess stops the transient unit of the process with the given id, and
+// resets it if it failed so it doesn't linger in `systemctl list-units`. It
+// waits for the stop job to be removed, which systemd does once the unit
+// stopped or its stop timeout expired, unless the context is done first.
+func (s *systemdDBus) StopProcess(ctx context.Context, id string) error {
+	unitName := id + ".service"
+
+	result := make(chan string, 1)
+	if _, err := s.manager.StopUnit(unitName, "replace", result); err != nil {
+		if isDBusError(err, errNoSuchUnit) {
+			glog.V(4).Infof("rkt: unit %q not loaded, not stopping it", unitName)
+			return nil
+		}
+		return fmt.Errorf("failed to stop unit %s: %v", unitName, err)
+	}
+	select {
+	case jobResult := <-result:
+		if jobResult != "done" {
+			return fmt.Errorf("failed to stop unit %s: %s", unitName, jobResult)
+		}
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop unit %s: %v", unitName, ctx.Err())
+	}
+
+	if err := s.manager.ResetFailedUnit(unitName); err != nil && !isDBusError(err, errNoSuchUnit) {
+		return fmt.Errorf("failed to reset unit %s: %v", unitName, err)
+	}
+	return nil
+}
+
+// RemoveProcess is a no-op: the unit was reset when it was stopped, and its
+// logs are kept in the journal.
+func (s *systemdDBus) RemoveProcess(id string) error {
+	return nil
+}
+
+// ProcessLogs returns the last log lines of the transient unit of the process
+// with the given id in the journal.
+func (s *systemdDBus) ProcessLogs(id string) string {
+	return unitLogs(s.execer, id+".service")
+}
+
+// ProcessStatus returns the status of the transient unit of the process with
+// the given id.
+func (s *systemdDBus) ProcessStatus(id string) (*ProcessStatus, error) {
+	unitName := id + ".service"
+
+	unitProps, err := s.manager.GetUnitProperties(unitName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get properties of unit %s: %v", unitName, err)
+	}
+	props := map[string]string{
+		"LoadState":   fmt.Sprint(unitProps["LoadState"]),
+		"ActiveState": fmt.Sprint(unitProps["ActiveState"]),
+	}
+	if props["LoadState"] != "not-found" {
+		serviceProps, err := s.manager.GetUnitTypeProperties(unitName, "Service")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get properties of unit %s: %v", unitName, err)
+		}
+		for _, name := range []string{"Result", "ExecMainCode", "ExecMainStatus"} {
+			props[name] = fmt.Sprint(serviceProps[name])
+		}
+	}
+	return unitStatus(unitName, props)
+}
+
+// Ready checks that systemd is the init system of the host and answers over
+// D-Bus.
+func (s *systemdDBus) Ready() error {
+	if _, err := os.Stat(systemdRuntimeDir); err != nil {
+		return fmt.Errorf("systemd doesn't seem to be running: %v", err)
+	}
+	if _, err := s.manager.GetManagerProperty("Version"); err != nil {
+		return fmt.Errorf("systemd doesn't answer over D-Bus: %v", err)
+	}
+	return nil
+}
+
+func isDBusError(err error, name string) bool {
+	dbusErr, ok := err.(dbus.Error)
+	return ok && dbusErr.Name == name
+}
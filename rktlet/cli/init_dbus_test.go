@@ -0,0 +1,253 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/dbus"
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	utilexec "k8s.io/utils/exec"
+)
+
+// fakeUnit is a transient unit of fakeSystemdManager.
+type fakeUnit struct {
+	props          map[string]dbus.Variant
+	activeState    string
+	result         string
+	execMainCode   int32
+	execMainStatus int32
+}
+
+// fakeSystemdManager starts units by running the given function, which
+// returns the result of the start job.
+type fakeSystemdManager struct {
+	start func(unit *fakeUnit) string
+	units map[string]*fakeUnit
+	calls []string
+}
+
+func newFakeSystemdManager(start func(unit *fakeUnit) string) *fakeSystemdManager {
+	return &fakeSystemdManager{start: start, units: make(map[string]*fakeUnit)}
+}
+
+func (m *fakeSystemdManager) StartTransientUnit(name string, mode string, properties []sddbus.Property, ch chan<- string) (int, error) {
+	m.calls = append(m.calls, "start "+name)
+	if _, ok := m.units[name]; ok {
+		return 0, dbus.Error{Name: "org.freedesktop.systemd1.UnitExists"}
+	}
+	unit := &fakeUnit{props: make(map[string]dbus.Variant), activeState: "activating"}
+	for _, prop := range properties {
+		unit.props[prop.Name] = prop.Value
+	}
+	m.units[name] = unit
+	ch <- m.start(unit)
+	return 1, nil
+}
+
+func (m *fakeSystemdManager) StopUnit(name string, mode string, ch chan<- string) (int, error) {
+	m.calls = append(m.calls, "stop "+name)
+	unit, ok := m.units[name]
+	if !ok {
+		return 0, dbus.Error{Name: errNoSuchUnit}
+	}
+	if unit.activeState != "failed" {
+		unit.activeState = "inactive"
+		delete(m.units, name)
+	}
+	ch <- "done"
+	return 2, nil
+}
+
+func (m *fakeSystemdManager) ResetFailedUnit(name string) error {
+	m.calls = append(m.calls, "reset-failed "+name)
+	unit, ok := m.units[name]
+	if !ok {
+		return dbus.Error{Name: errNoSuchUnit}
+	}
+	if unit.activeState == "failed" {
+		delete(m.units, name)
+	}
+	return nil
+}
+
+func (m *fakeSystemdManager) GetUnitProperties(name string) (map[string]interface{}, error) {
+	unit, ok := m.units[name]
+	if !ok {
+		return map[string]interface{}{"LoadState": "not-found", "ActiveState": "inactive"}, nil
+	}
+	return map[string]interface{}{"LoadState": "loaded", "ActiveState": unit.activeState}, nil
+}
+
+func (m *fakeSystemdManager) GetUnitTypeProperties(name string, unitType string) (map[string]interface{}, error) {
+	unit, ok := m.units[name]
+	if !ok || unitType != "Service" {
+		return nil, dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownInterface"}
+	}
+	return map[string]interface{}{
+		"Result":         unit.result,
+		"ExecMainCode":   unit.execMainCode,
+		"ExecMainStatus": unit.execMainStatus,
+	}, nil
+}
+
+func (m *fakeSystemdManager) GetManagerProperty(prop string) (string, error) {
+	if prop == "Version" {
+		return `"233"`, nil
+	}
+	return "", errors.New("unknown property")
+}
+
+func (m *fakeSystemdManager) Close() {}
+
+// noJournalExecer doesn't find journalctl.
+type noJournalExecer struct {
+	utilexec.Interface
+}
+
+func (noJournalExecer) LookPath(file string) (string, error) {
+	return "", exec.ErrNotFound
+}
+
+func TestSystemdDBusStartProcess(t *testing.T) {
+	manager := newFakeSystemdManager(func(unit *fakeUnit) string {
+		unit.activeState = "active"
+		unit.result = "success"
+		return "done"
+	})
+	s := &systemdDBus{SystemdConfig: SystemdConfig{ReadyTimeout: 2 * time.Second}, manager: manager, execer: noJournalExecer{}}
+
+	cgroupParent := "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice"
+	id, err := s.StartProcess(cgroupParent, "/usr/bin/rkt", "app", "sandbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unit := manager.units[id+".service"]
+	if assert.NotNil(t, unit) {
+		assert.Equal(t, "notify", unit.props["Type"].Value())
+		assert.Equal(t, "kubepods-besteffort-pod1234.slice", unit.props["Slice"].Value())
+		assert.Equal(t, []string{"RKT_EXPERIMENT_APP=true", "RKT_EXPERIMENT_ATTACH=true"}, unit.props["Environment"].Value())
+		assert.Equal(t, uint64(2000000), unit.props["TimeoutStartUSec"].Value())
+		assert.Equal(t, sddbus.PropExecStart([]string{"/usr/bin/rkt", "app", "sandbox"}, false).Value, unit.props["ExecStart"])
+	}
+
+	status, err := s.ProcessStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{Running: true, Ready: true}, status)
+
+	assert.NoError(t, s.StopProcess(context.Background(), id))
+	assert.Empty(t, manager.units)
+
+	// Stopping is idempotent.
+	assert.NoError(t, s.StopProcess(context.Background(), id))
+	_, err = s.ProcessStatus(id)
+	assert.Error(t, err)
+
+	// Sandboxes can only be placed in slices.
+	_, err = s.StartProcess("/kubepods/besteffort/pod1234", "/usr/bin/rkt", "app", "sandbox")
+	assert.Error(t, err)
+}
+
+func TestSystemdDBusStartProcessFailure(t *testing.T) {
+	manager := newFakeSystemdManager(func(unit *fakeUnit) string {
+		unit.activeState = "failed"
+		unit.result = "exit-code"
+		unit.execMainCode = 1
+		unit.execMainStatus = 254
+		return "failed"
+	})
+	s := &systemdDBus{manager: manager, execer: noJournalExecer{}}
+
+	_, err := s.StartProcess("", "/usr/bin/rkt", "app", "sandbox")
+	startErr, ok := err.(*UnitStartError)
+	if !ok {
+		t.Fatalf("expected a *UnitStartError, got %#v", err)
+	}
+	assert.Equal(t, "failed", startErr.JobResult)
+	assert.Equal(t, &ProcessStatus{ExitCode: 254, Reason: "exit-code"}, startErr.Status)
+	assert.Contains(t, err.Error(), "failed (exit-code) with exit code 254")
+
+	// The failed unit was reset.
+	assert.Empty(t, manager.units)
+	assert.Equal(t, []string{"start " + startErr.Unit, "stop " + startErr.Unit, "reset-failed " + startErr.Unit}, manager.calls)
+}
+
+// stuckSystemdManager never finishes stop jobs.
+type stuckSystemdManager struct {
+	*fakeSystemdManager
+}
+
+func (m *stuckSystemdManager) StopUnit(name string, mode string, ch chan<- string) (int, error) {
+	return 2, nil
+}
+
+func TestSystemdDBusStopProcessContext(t *testing.T) {
+	s := &systemdDBus{manager: &stuckSystemdManager{newFakeSystemdManager(nil)}, execer: noJournalExecer{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := s.StopProcess(ctx, "rktlet-abc")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	}
+}
+
+// closedSystemdManager is a systemdManager whose connection was closed.
+type closedSystemdManager struct {
+	*fakeSystemdManager
+	closed bool
+}
+
+func (m *closedSystemdManager) GetManagerProperty(prop string) (string, error) {
+	return "", dbus.ErrClosed
+}
+
+func (m *closedSystemdManager) Close() {
+	m.closed = true
+}
+
+func TestReconnectingManager(t *testing.T) {
+	closed := &closedSystemdManager{fakeSystemdManager: newFakeSystemdManager(nil)}
+	connections := []systemdManager{closed, newFakeSystemdManager(nil)}
+	manager, err := newReconnectingManager(func() (systemdManager, error) {
+		if len(connections) == 0 {
+			return nil, errors.New("no more connections")
+		}
+		conn := connections[0]
+		connections = connections[1:]
+		return conn, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	version, err := manager.GetManagerProperty("Version")
+	assert.NoError(t, err)
+	assert.Equal(t, `"233"`, version)
+	assert.True(t, closed.closed)
+	assert.Empty(t, connections)
+
+	// The new connection is kept.
+	_, err = manager.GetManagerProperty("Version")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,356 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+)
+
+const (
+	// The files kept in the state directory of each process.
+	processPidFile    = "pid"
+	processExitFile   = "exit"
+	processOutputFile = "output.log"
+
+	// processStopTimeout is how long a process has to exit once it's sent
+	// SIGTERM, before it's sent SIGKILL.
+	processStopTimeout = 10 * time.Second
+	// processPollInterval is how often a stopping process is checked.
+	processPollInterval = 100 * time.Millisecond
+	// processOutputTailSize is how much of the end of the output of a
+	// process is read to find its last lines.
+	processOutputTailSize = 64 * 1024
+)
+
+// processInit runs processes as children of rktlet, for hosts without
+// systemd. Each process gets a directory named after its id, which holds its
+// pid and start time, to tell it from a later process reusing its pid, its
+// exit status once it was reaped, and its stdout and stderr. The processes
+// run in sessions of their own, so they outlive rktlet. Those exiting while
+// rktlet isn't running, and the processes of their groups left behind by
+// their leaders, are reaped by the PID 1 of the PID namespace, which must
+// reap orphans; their exit status is lost.
+type processInit struct {
+	dir string
+
+	lock sync.Mutex
+	// children are the ids of the processes started by this rktlet whose
+	// exit status isn't recorded yet.
+	children map[string]bool
+}
+
+// NewProcessInit creates an Init object running processes itself, keeping
+// their state in subdirectories of the given directory.
+func NewProcessInit(dir string) Init {
+	if os.Getpid() == 1 {
+		glog.Warningf("rkt: rktlet is PID 1, the orphaned processes of pod sandboxes won't be reaped: please run rktlet under an init reaping them")
+	}
+	return &processInit{dir: dir, children: make(map[string]bool)}
+}
+
+// StartProcess runs the 'command + args' in the cgroup parent, and returns
+// as soon as it's started: readiness notifications aren't supported.
+func (p *processInit) StartProcess(cgroupParent, command string, args ...string) (string, error) {
+	id := fmt.Sprintf("rktlet-%s", uuid.New())
+	stateDir := filepath.Join(p.dir, id)
+
+	sandboxCmd := append([]string{command}, args...)
+	if cgroupParent != "" {
+		// With both cgroup drivers, the cgroup parent is a path in the
+		// cgroup hierarchies; the systemd one just names it after slices.
+		var err error
+		if sandboxCmd, err = cgroupfsCommand(cgroupParent, sandboxCmd); err != nil {
+			glog.Warningf("rkt: %v", err)
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create state directory of process %s: %v", id, err)
+	}
+	output, err := os.OpenFile(filepath.Join(stateDir, processOutputFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		os.RemoveAll(stateDir)
+		return "", fmt.Errorf("unable to create output file of process %s: %v", id, err)
+	}
+	defer output.Close()
+
+	glog.V(4).Infof("rkt: starting process %s running %s %v", id, command, args)
+
+	cmd := exec.Command(sandboxCmd[0], sandboxCmd[1:]...)
+	cmd.Env = append(os.Environ(), "RKT_EXPERIMENT_APP=true", "RKT_EXPERIMENT_ATTACH=true")
+	// The output goes straight to the file, so it's still captured once
+	// rktlet is gone.
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// A new session keeps the process from the signals sent to the session
+	// of rktlet, e.g. SIGHUP when it ends.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(stateDir)
+		return "", fmt.Errorf("failed to start process %s: %v", id, err)
+	}
+
+	// The process can't be gone before it's reaped, so it has a start time.
+	_, _, startTime, err := processStat(cmd.Process.Pid)
+	if err == nil {
+		pidData := fmt.Sprintf("%d %s\n", cmd.Process.Pid, startTime)
+		err = ioutil.WriteFile(filepath.Join(stateDir, processPidFile), []byte(pidData), 0600)
+	}
+	if err != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+		os.RemoveAll(stateDir)
+		return "", fmt.Errorf("unable to record pid of process %s: %v", id, err)
+	}
+
+	p.lock.Lock()
+	p.children[id] = true
+	p.lock.Unlock()
+	go p.reap(id, cmd)
+	return id, nil
+}
+
+// reap waits for a process to exit, and records how it did.
+func (p *processInit) reap(id string, cmd *exec.Cmd) {
+	cmd.Wait()
+
+	exitCode, reason := 0, "success"
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		exitCode, reason = -1, "signal"
+	} else if exitCode = ws.ExitStatus(); exitCode != 0 {
+		reason = "exit-code"
+	}
+	glog.V(4).Infof("rkt: process %s exited (%s) with exit code %d", id, reason, exitCode)
+
+	exitData := fmt.Sprintf("%d %s\n", exitCode, reason)
+	if err := ioutil.WriteFile(filepath.Join(p.dir, id, processExitFile), []byte(exitData), 0600); err != nil {
+		// The process was stopped and forgotten already.
+		glog.V(4).Infof("rkt: unable to record exit status of process %s: %v", id, err)
+	}
+
+	p.lock.Lock()
+	delete(p.children, id)
+	p.lock.Unlock()
+}
+
+// StopProcess sends SIGTERM to the process group of the process with the
+// given id, then SIGKILL if it's still running after processStopTimeout. The
+// group is stopped even if the process itself exited already. Its state
+// directory is kept, with its output, until it's removed.
+func (p *processInit) StopProcess(ctx context.Context, id string) error {
+	pid, startTime, err := p.readPid(id)
+	if os.IsNotExist(err) {
+		glog.V(4).Infof("rkt: process %q not found, not stopping it", id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if groupRunning(pid, startTime) {
+		if err := stopProcessGroup(ctx, pid, startTime); err != nil {
+			return fmt.Errorf("failed to stop process %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// RemoveProcess removes the state directory of a stopped process.
+func (p *processInit) RemoveProcess(id string) error {
+	if err := os.RemoveAll(filepath.Join(p.dir, id)); err != nil {
+		return fmt.Errorf("unable to remove state directory of process %s: %v", id, err)
+	}
+	return nil
+}
+
+// ProcessStatus returns the status of the process with the given id.
+func (p *processInit) ProcessStatus(id string) (*ProcessStatus, error) {
+	pid, startTime, err := p.readPid(id)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("process %q not found", id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	// Children are running until their exit status is recorded.
+	running := p.children[id]
+	p.lock.Unlock()
+	// The process is still running as long as its group is, e.g. when it
+	// exited while the stage1 it started is running.
+	if running || groupRunning(pid, startTime) {
+		return &ProcessStatus{Running: true}, nil
+	}
+
+	exitData, err := ioutil.ReadFile(filepath.Join(p.dir, id, processExitFile))
+	if os.IsNotExist(err) {
+		// The process exited while rktlet wasn't running.
+		return &ProcessStatus{ExitCode: -1, Reason: "unknown"}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read exit status of process %q: %v", id, err)
+	}
+	status := &ProcessStatus{}
+	if _, err := fmt.Sscan(string(exitData), &status.ExitCode, &status.Reason); err != nil {
+		return nil, fmt.Errorf("invalid exit status of process %q: %v", id, err)
+	}
+	if status.Reason == "success" {
+		status.Reason = ""
+	}
+	return status, nil
+}
+
+// ProcessLogs returns the last lines of the output of the process with the
+// given id.
+func (p *processInit) ProcessLogs(id string) string {
+	output, err := os.Open(filepath.Join(p.dir, id, processOutputFile))
+	if err != nil {
+		return ""
+	}
+	defer output.Close()
+
+	if _, err := output.Seek(-processOutputTailSize, io.SeekEnd); err != nil {
+		// The output is smaller than the tail.
+		output.Seek(0, io.SeekStart)
+	}
+	data, err := ioutil.ReadAll(output)
+	if err != nil {
+		glog.Warningf("rkt: unable to read output of process %q: %v", id, err)
+		return ""
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > logLines {
+		lines = lines[len(lines)-logLines:]
+	}
+	return strings.Join(lines, "")
+}
+
+// Ready checks that the state directories of the processes can be created.
+func (p *processInit) Ready() error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create process state directory: %v", err)
+	}
+	return nil
+}
+
+// readPid returns the pid and start time of the process with the given id.
+// The error satisfies os.IsNotExist if the process isn't known.
+func (p *processInit) readPid(id string) (int, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(p.dir, id, processPidFile))
+	if err != nil {
+		return 0, "", err
+	}
+	var pid int
+	var startTime string
+	if _, err := fmt.Sscan(string(data), &pid, &startTime); err != nil {
+		return 0, "", fmt.Errorf("invalid pid file of process %q: %v", id, err)
+	}
+	return pid, startTime, nil
+}
+
+// stopProcessGroup stops the process group of a session leader, unless the
+// context is done first.
+func stopProcessGroup(ctx context.Context, pid int, startTime string) error {
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		for deadline := time.Now().Add(processStopTimeout); time.Now().Before(deadline); {
+			if !groupRunning(pid, startTime) {
+				return nil
+			}
+			select {
+			case <-time.After(processPollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return fmt.Errorf("process %d still running after SIGKILL", pid)
+}
+
+// groupRunning returns whether any process of the group led by the process
+// with the given pid and start time is running, whether the leader exited or
+// not. Zombies aren't running. A pid isn't reused while it's the id of a group
+// with members, so the group is gone once another process has the pid of its
+// leader.
+func groupRunning(pgid int, startTime string) bool {
+	if _, _, st, err := processStat(pgid); err == nil && st != startTime {
+		return false
+	}
+
+	proc, err := os.Open(util.ProcRoot)
+	if err != nil {
+		glog.Warningf("rkt: unable to list processes: %v", err)
+		return false
+	}
+	defer proc.Close()
+	names, err := proc.Readdirnames(-1)
+	if err != nil {
+		glog.Warningf("rkt: unable to list processes: %v", err)
+		return false
+	}
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		state, pgrp, _, err := processStat(pid)
+		if err == nil && pgrp == pgid && state != "Z" && state != "X" {
+			return true
+		}
+	}
+	return false
+}
+
+// processStat returns the state, the process group and the start time of the
+// process with the given pid, see proc(5).
+func processStat(pid int) (string, int, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(util.ProcRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", 0, "", err
+	}
+	// The name of the command, between parentheses, may contain spaces, so
+	// the fields are counted from its end.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return "", 0, "", fmt.Errorf("invalid stat of process %d: %q", pid, stat)
+	}
+	pgrp, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, "", fmt.Errorf("invalid stat of process %d: %q", pid, stat)
+	}
+	return fields[0], pgrp, fields[19], nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// waitProcessExit waits for a process to exit and returns its status.
+func waitProcessExit(t *testing.T, init Init, id string) *ProcessStatus {
+	for i := 0; i < 100; i++ {
+		status, err := init.ProcessStatus(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !status.Running {
+			return status
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("process %s still running", id)
+	return nil
+}
+
+func TestProcessInit(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_process_init")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	p := NewProcessInit(tmpDir)
+	assert.NoError(t, p.Ready())
+
+	id, err := p.StartProcess("", "/bin/sh", "-c", `echo out; echo err >&2; echo "$RKT_EXPERIMENT_APP"; exec sleep 100`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status, err := p.ProcessStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{Running: true}, status)
+
+	// The process is still known after a restart of rktlet.
+	restarted := NewProcessInit(tmpDir)
+	status, err = restarted.ProcessStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{Running: true}, status)
+
+	// Let the process write its output before it's stopped.
+	for i := 0; i < 100 && p.ProcessLogs(id) != "out\nerr\ntrue\n"; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.NoError(t, restarted.StopProcess(context.Background(), id))
+	waitProcessExit(t, p, id)
+	// Stopping is idempotent.
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+	// The output is kept until the process is removed.
+	assert.Equal(t, "out\nerr\ntrue\n", p.ProcessLogs(id))
+	assert.NoError(t, p.RemoveProcess(id))
+	_, err = os.Stat(filepath.Join(tmpDir, id))
+	assert.True(t, os.IsNotExist(err))
+	_, err = p.ProcessStatus(id)
+	assert.Error(t, err)
+	assert.Equal(t, "", p.ProcessLogs(id))
+	assert.NoError(t, p.RemoveProcess(id))
+
+	// The output is captured.
+	id, err = p.StartProcess("", "/bin/sh", "-c", `echo out; echo err >&2; echo "$RKT_EXPERIMENT_APP"; exit 3`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, &ProcessStatus{ExitCode: 3, Reason: "exit-code"}, waitProcessExit(t, p, id))
+	output, err := ioutil.ReadFile(filepath.Join(tmpDir, id, processOutputFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "out\nerr\ntrue\n", string(output))
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+
+	// Only the last lines of the output are logged.
+	id, err = p.StartProcess("", "/bin/sh", "-c", "seq 100")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitProcessExit(t, p, id)
+	var lastLines string
+	for i := 100 - logLines + 1; i <= 100; i++ {
+		lastLines += fmt.Sprintf("%d\n", i)
+	}
+	assert.Equal(t, lastLines, p.ProcessLogs(id))
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+
+	id, err = p.StartProcess("", "/bin/sh", "-c", "kill -9 $$")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, &ProcessStatus{ExitCode: -1, Reason: "signal"}, waitProcessExit(t, p, id))
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+
+	// A process whose pid was reused exited while rktlet wasn't running.
+	id = "rktlet-reused"
+	if err := os.Mkdir(filepath.Join(tmpDir, id), 0700); err != nil {
+		t.Fatalf("unable to create state directory: %v", err)
+	}
+	pidData := fmt.Sprintf("%d 0\n", os.Getpid())
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, id, processPidFile), []byte(pidData), 0600); err != nil {
+		t.Fatalf("unable to write pid file: %v", err)
+	}
+	status, err = p.ProcessStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{ExitCode: -1, Reason: "unknown"}, status)
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+}
+
+func TestProcessInitGroup(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_process_init")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	p := NewProcessInit(tmpDir)
+	// The process exits, leaving a process of its group behind.
+	id, err := p.StartProcess("", "/bin/sh", "-c", "sleep 100 & echo started")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 100 && p.ProcessLogs(id) == ""; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	status, err := p.ProcessStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{Running: true}, status)
+
+	// The rest of the group is stopped.
+	assert.NoError(t, p.StopProcess(context.Background(), id))
+	assert.Equal(t, &ProcessStatus{}, waitProcessExit(t, p, id))
+	assert.NoError(t, p.RemoveProcess(id))
+}
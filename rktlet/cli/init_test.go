@@ -18,9 +18,15 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	utilexec "k8s.io/utils/exec"
 )
 
 func TestCgroupParentToSliceName(t *testing.T) {
@@ -51,3 +57,95 @@ func TestCgroupParentToSliceName(t *testing.T) {
 	}
 
 }
+
+func TestSystemdProcesses(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_init")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A fake systemctl knowing of a running, a failed and a killed unit, and
+	// logging its commands.
+	logPath := filepath.Join(tmpDir, "log")
+	systemctlPath := filepath.Join(tmpDir, "systemctl")
+	script := `#!/bin/sh
+echo "$1 $2" >> ` + logPath + `
+case "$1 $2" in
+"show rktlet-running") printf 'LoadState=loaded\nActiveState=active\nResult=success\nExecMainCode=0\nExecMainStatus=0\n' ;;
+"show rktlet-failed") printf 'LoadState=loaded\nActiveState=failed\nResult=exit-code\nExecMainCode=1\nExecMainStatus=3\n' ;;
+"show rktlet-killed") printf 'LoadState=loaded\nActiveState=failed\nResult=signal\nExecMainCode=2\nExecMainStatus=9\n' ;;
+"show "*) printf 'LoadState=not-found\nActiveState=inactive\n' ;;
+*" rktlet-gone") echo "Failed to $1 rktlet-gone.service: Unit rktlet-gone.service not loaded." >&2; exit 5 ;;
+esac
+`
+	if err := ioutil.WriteFile(systemctlPath, []byte(script), 0755); err != nil {
+		t.Fatalf("unable to write fake systemctl: %v", err)
+	}
+
+	s := NewSystemd("systemd-run", systemctlPath, SystemdConfig{}, utilexec.New())
+
+	status, err := s.ProcessStatus("rktlet-running")
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{Running: true, Ready: true}, status)
+
+	status, err = s.ProcessStatus("rktlet-failed")
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{ExitCode: 3, Reason: "exit-code"}, status)
+
+	status, err = s.ProcessStatus("rktlet-killed")
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessStatus{ExitCode: -1, Reason: "signal"}, status)
+
+	_, err = s.ProcessStatus("rktlet-gone")
+	assert.Error(t, err)
+
+	// Stopping is idempotent.
+	assert.NoError(t, s.StopProcess(context.Background(), "rktlet-failed"))
+	assert.NoError(t, s.StopProcess(context.Background(), "rktlet-gone"))
+
+	log, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("unable to read log: %v", err)
+	}
+	assert.Contains(t, string(log), "stop rktlet-failed\nreset-failed rktlet-failed\nstop rktlet-gone\nreset-failed rktlet-gone\n")
+}
+
+func TestSystemdStartProcessFailure(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_init")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origPath := os.Getenv("PATH")
+	os.Setenv("PATH", tmpDir+":"+origPath)
+	defer os.Setenv("PATH", origPath)
+
+	// The stage1 fails to start: systemd-run fails and the unit is left
+	// failed with its logs in the journal.
+	argsPath := filepath.Join(tmpDir, "args")
+	scripts := map[string]string{
+		"systemd-run": "echo \"$@\" > " + argsPath + "\necho 'Job for rktlet-x.service failed.' >&2\nexit 1\n",
+		"systemctl":   "[ \"$1\" = show ] && printf 'LoadState=loaded\\nActiveState=failed\\nResult=timeout\\nExecMainCode=2\\nExecMainStatus=15\\n'\nexit 0\n",
+		"journalctl":  "echo 'stage1: unable to set up networking'\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("unable to write fake %s: %v", name, err)
+		}
+	}
+
+	s := NewSystemd(filepath.Join(tmpDir, "systemd-run"), filepath.Join(tmpDir, "systemctl"), SystemdConfig{ReadyTimeout: 1500 * time.Millisecond}, utilexec.New())
+	_, err = s.StartProcess("", "rkt", "app", "sandbox")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed (timeout) with exit code -1")
+		assert.Contains(t, err.Error(), "stage1: unable to set up networking")
+	}
+
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("unable to read args: %v", err)
+	}
+	assert.Contains(t, string(args), "--service-type=notify --property=TimeoutStartSec=1500ms rkt app sandbox")
+}
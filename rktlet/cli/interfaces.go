@@ -16,18 +16,74 @@ limitations under the License.
 
 package cli
 
+import (
+	appcschema "github.com/appc/spec/schema"
+	rkt "github.com/rkt/rkt/api/v1"
+	"golang.org/x/net/context"
+)
+
 // CLI is an interface for interacting with the rkt command line interface
 type CLI interface {
 	With(CLIConfig) CLI
 	RunCommand(string, ...string) ([]string, error)
+	// RunCommandContext is like RunCommand, but rkt is killed if the context
+	// is done before the command completes.
+	RunCommandContext(context.Context, string, ...string) ([]string, error)
 	Command(string, ...string) []string
 }
 
+// Reader reads the pods and images of rkt, in the format of its commands
+// printing JSON.
+type Reader interface {
+	// ListPods lists the pods, like `rkt list`.
+	ListPods(context.Context) ([]rkt.Pod, error)
+	// InspectPod returns the status of a pod, like `rkt status`.
+	InspectPod(ctx context.Context, uuid string) (*rkt.Pod, error)
+	// InspectApp returns the status of an app, like `rkt app status`.
+	InspectApp(ctx context.Context, uuid, appName string) (*rkt.App, error)
+	// ListImages lists the images sorted by import time, like
+	// `rkt image list --sort=importtime`.
+	ListImages(context.Context) ([]rkt.ImageListEntry, error)
+	// InspectImage returns the manifest of an image, like
+	// `rkt image cat-manifest`.
+	InspectImage(ctx context.Context, id string) (*appcschema.ImageManifest, error)
+}
+
 // Init is an interface for interacting with the init system on the host
 // (e.g. systemd), to run rkt commands.
 type Init interface {
 	StartProcess(cgroupParent, command string, args ...string) (id string, err error)
-	// TODO(yifan): Add StopProcess?
+	// StopProcess stops the process with the given id if it's still running.
+	// Stopping a process which doesn't exist anymore isn't an error. It stops
+	// waiting for the process to exit when the context is done.
+	StopProcess(ctx context.Context, id string) error
+	// RemoveProcess forgets about a stopped process, and removes what was
+	// kept of it, e.g. its output. Removing a process which doesn't exist
+	// anymore isn't an error.
+	RemoveProcess(id string) error
+	// ProcessStatus returns the status of the process with the given id.
+	ProcessStatus(id string) (*ProcessStatus, error)
+	// ProcessLogs returns the last lines of the output of the process with
+	// the given id, or an empty string if they can't be read.
+	ProcessLogs(id string) string
+	// Ready returns an error if processes can't be started through the init
+	// system.
+	Ready() error
+}
+
+// ProcessStatus is the status of a process started by an Init.
+type ProcessStatus struct {
+	// Running is whether the process is starting or running.
+	Running bool
+	// Ready is whether the process notified it's ready. It's never set by the
+	// Inits which don't support notifications.
+	Ready bool
+	// ExitCode is the exit code of the process once it exited, or -1 if it
+	// was killed by a signal.
+	ExitCode int
+	// Reason describes why the process failed, e.g. "exit-code" or
+	// "timeout". It's empty if the process is running or succeeded.
+	Reason string
 }
 
 //go:generate ../../hack/generate/mockery.sh . CLI ./mocks/cli.go
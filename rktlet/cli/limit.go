@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// limitedCLI runs at most as many commands of the wrapped CLI at once as
+// there are slots. The commands only reading pods or images have slots of
+// their own, so the lists and statuses polled by the kubelet aren't held up
+// by image pulls or pods being started. The commands waiting for a slot are
+// run in no particular order.
+type limitedCLI struct {
+	CLI
+	slots     chan struct{}
+	readSlots chan struct{}
+}
+
+// NewLimitedCLI returns a CLI running at most max commands changing pods or
+// images, and max commands reading them, of the given CLI at once. The CLIs
+// returned by its With method share the same limits. If max isn't positive,
+// the given CLI is returned.
+func NewLimitedCLI(cli CLI, max int) CLI {
+	if max <= 0 {
+		return cli
+	}
+	return &limitedCLI{
+		CLI:       cli,
+		slots:     make(chan struct{}, max),
+		readSlots: make(chan struct{}, max),
+	}
+}
+
+func (c *limitedCLI) With(cfg CLIConfig) CLI {
+	return &limitedCLI{CLI: c.CLI.With(cfg), slots: c.slots, readSlots: c.readSlots}
+}
+
+func (c *limitedCLI) RunCommand(subCmd string, args ...string) ([]string, error) {
+	return c.RunCommandContext(context.Background(), subCmd, args...)
+}
+
+// RunCommandContext waits for a slot, or for the context to be done, before
+// running the command.
+func (c *limitedCLI) RunCommandContext(ctx context.Context, subCmd string, args ...string) ([]string, error) {
+	slots := c.slots
+	if isReadOnly(subCmd, args) {
+		slots = c.readSlots
+	}
+	select {
+	case slots <- struct{}{}:
+	default:
+		glog.V(4).Infof("rkt: %d commands running, waiting to run %v %v", cap(slots), subCmd, args)
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, newError(ctx, subCmd, args, "", ctx.Err())
+		}
+	}
+	defer func() { <-slots }()
+
+	return c.CLI.RunCommandContext(ctx, subCmd, args...)
+}
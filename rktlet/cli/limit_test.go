@@ -0,0 +1,110 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// blockingCLI blocks every command until it's released, and counts how many
+// are running at once.
+type blockingCLI struct {
+	release chan struct{}
+
+	lock       sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func (c *blockingCLI) With(CLIConfig) CLI {
+	return c
+}
+
+func (c *blockingCLI) RunCommand(subCmd string, args ...string) ([]string, error) {
+	return c.RunCommandContext(context.Background(), subCmd, args...)
+}
+
+func (c *blockingCLI) RunCommandContext(ctx context.Context, subCmd string, args ...string) ([]string, error) {
+	c.lock.Lock()
+	c.running++
+	if c.running > c.maxRunning {
+		c.maxRunning = c.running
+	}
+	c.lock.Unlock()
+
+	<-c.release
+
+	c.lock.Lock()
+	c.running--
+	c.lock.Unlock()
+	return nil, nil
+}
+
+func (c *blockingCLI) Command(subCmd string, args ...string) []string {
+	return append([]string{subCmd}, args...)
+}
+
+func TestLimitedCLI(t *testing.T) {
+	execCli := &blockingCLI{release: make(chan struct{})}
+	assert.Equal(t, execCli, NewLimitedCLI(execCli, 0))
+
+	c := NewLimitedCLI(execCli, 2)
+	other := c.With(CLIConfig{Debug: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.RunCommand("list")
+		}()
+		go func() {
+			defer wg.Done()
+			other.RunCommand("list")
+		}()
+	}
+
+	// A command waiting for a slot gives up when its context is done.
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.RunCommandContext(ctx, "list")
+	assert.True(t, IsErrorKind(err, ErrTimeout))
+
+	// Commands changing pods or images have slots of their own.
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.RunCommand("fetch", "docker://busybox")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.RunCommandContext(ctx, "image", "rm", "sha512-foo")
+	assert.True(t, IsErrorKind(err, ErrTimeout))
+
+	close(execCli.release)
+	wg.Wait()
+	assert.Equal(t, 4, execCli.maxRunning)
+}
@@ -20,6 +20,8 @@ package mocks
 import "github.com/kubernetes-incubator/rktlet/rktlet/cli"
 import "github.com/stretchr/testify/mock"
 
+import context "golang.org/x/net/context"
+
 // CLI is an autogenerated mock type for the CLI type
 type CLI struct {
 	mock.Mock
@@ -64,6 +66,29 @@ func (_m *CLI) RunCommand(_a0 string, _a1 ...string) ([]string, error) {
 	return r0, r1
 }
 
+// RunCommandContext provides a mock function with given fields: _a0, _a1, _a2
+func (_m *CLI) RunCommandContext(_a0 context.Context, _a1 string, _a2 ...string) ([]string, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...string) []string); ok {
+		r0 = rf(_a0, _a1, _a2...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...string) error); ok {
+		r1 = rf(_a0, _a1, _a2...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // With provides a mock function with given fields: _a0
 func (_m *CLI) With(_a0 cli.CLIConfig) cli.CLI {
 	ret := _m.Called(_a0)
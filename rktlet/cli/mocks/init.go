@@ -17,7 +17,9 @@ limitations under the License.
 // Code generated by Mockery for Init. This code should not be edited by hand
 package mocks
 
+import "github.com/kubernetes-incubator/rktlet/rktlet/cli"
 import "github.com/stretchr/testify/mock"
+import context "golang.org/x/net/context"
 
 // Init is an autogenerated mock type for the Init type
 type Init struct {
@@ -44,3 +46,82 @@ func (_m *Init) StartProcess(cgroupParent string, command string, args ...string
 
 	return r0, r1
 }
+
+// StopProcess provides a mock function with given fields: ctx, id
+func (_m *Init) StopProcess(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveProcess provides a mock function with given fields: id
+func (_m *Init) RemoveProcess(id string) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ProcessLogs provides a mock function with given fields: id
+func (_m *Init) ProcessLogs(id string) string {
+	ret := _m.Called(id)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// ProcessStatus provides a mock function with given fields: id
+func (_m *Init) ProcessStatus(id string) (*cli.ProcessStatus, error) {
+	ret := _m.Called(id)
+
+	var r0 *cli.ProcessStatus
+	if rf, ok := ret.Get(0).(func(string) *cli.ProcessStatus); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*cli.ProcessStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ready provides a mock function with given fields:
+func (_m *Init) Ready() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
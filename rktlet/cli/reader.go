@@ -0,0 +1,97 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appcschema "github.com/appc/spec/schema"
+	rkt "github.com/rkt/rkt/api/v1"
+	"golang.org/x/net/context"
+)
+
+// cliReader reads pods and images by running rkt.
+type cliReader struct {
+	cli CLI
+}
+
+// NewCLIReader returns a Reader running rkt with the given CLI.
+func NewCLIReader(cli CLI) Reader {
+	return &cliReader{cli: cli}
+}
+
+func (r *cliReader) ListPods(ctx context.Context) ([]rkt.Pod, error) {
+	var pods []rkt.Pod
+	if err := r.runJSON(ctx, &pods, "list", "--format=json"); err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+func (r *cliReader) InspectPod(ctx context.Context, uuid string) (*rkt.Pod, error) {
+	var pod rkt.Pod
+	if err := r.runJSON(ctx, &pod, "status", uuid, "--format=json"); err != nil {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+func (r *cliReader) InspectApp(ctx context.Context, uuid, appName string) (*rkt.App, error) {
+	var app rkt.App
+	if err := r.runJSON(ctx, &app, "app", "status", uuid, "--app="+appName, "--format=json"); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (r *cliReader) ListImages(ctx context.Context) ([]rkt.ImageListEntry, error) {
+	var images []rkt.ImageListEntry
+	if err := r.runJSON(ctx, &images, "image", "list", "--full", "--format=json", "--sort=importtime"); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *cliReader) InspectImage(ctx context.Context, id string) (*appcschema.ImageManifest, error) {
+	output, err := r.cli.RunCommandContext(ctx, "image", "cat-manifest", id)
+	if err != nil {
+		return nil, err
+	}
+	var manifest appcschema.ImageManifest
+	if err := json.Unmarshal([]byte(strings.Join(output, "")), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the manifest of image %q: %v", id, err)
+	}
+	return &manifest, nil
+}
+
+// runJSON runs a rkt command printing JSON on a single line, and unmarshals
+// its output into v.
+func (r *cliReader) runJSON(ctx context.Context, v interface{}, subCmd string, args ...string) error {
+	output, err := r.cli.RunCommandContext(ctx, subCmd, args...)
+	if err != nil {
+		return err
+	}
+	if len(output) != 1 {
+		return fmt.Errorf("unexpected result %q of %v %v", output, subCmd, args)
+	}
+	if err := json.Unmarshal([]byte(output[0]), v); err != nil {
+		return fmt.Errorf("failed to unmarshal the result of %v %v: %v", subCmd, args, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// retryBackoff is how the read-only rkt commands failing because another rkt
+// process holds a lock are retried: up to 4 more times, over about 2s.
+var retryBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    5,
+}
+
+// retryingCLI retries the read-only commands of the wrapped CLI failing
+// because of lock contention. Wrapping a limited CLI releases its slot while
+// waiting to retry.
+type retryingCLI struct {
+	CLI
+}
+
+// NewRetryingCLI returns a CLI retrying the read-only commands of the given
+// CLI which fail because another rkt process holds a lock.
+func NewRetryingCLI(cli CLI) CLI {
+	return &retryingCLI{cli}
+}
+
+func (c *retryingCLI) With(cfg CLIConfig) CLI {
+	return &retryingCLI{c.CLI.With(cfg)}
+}
+
+func (c *retryingCLI) RunCommand(subCmd string, args ...string) ([]string, error) {
+	return c.RunCommandContext(context.Background(), subCmd, args...)
+}
+
+func (c *retryingCLI) RunCommandContext(ctx context.Context, subCmd string, args ...string) ([]string, error) {
+	if !isReadOnly(subCmd, args) {
+		return c.CLI.RunCommandContext(ctx, subCmd, args...)
+	}
+	return retryCommand(ctx, subCmd, args, func() ([]string, error) {
+		return c.CLI.RunCommandContext(ctx, subCmd, args...)
+	})
+}
+
+var retries = struct {
+	sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// RetryCounts returns how many times each rkt command, e.g. "image list", was
+// retried since rktlet started.
+func RetryCounts() map[string]int64 {
+	retries.Lock()
+	defer retries.Unlock()
+
+	counts := make(map[string]int64, len(retries.counts))
+	for cmd, count := range retries.counts {
+		counts[cmd] = count
+	}
+	return counts
+}
+
+// LogRetryCounts logs the retry counts at verbosity 2 every period, when they
+// changed, until stop is closed. They help debugging the contention with
+// other rkt processes, e.g. garbage collection.
+func LogRetryCounts(period time.Duration, stop <-chan struct{}) {
+	logged := map[string]int64{}
+	wait.Until(func() {
+		counts := RetryCounts()
+		if reflect.DeepEqual(counts, logged) {
+			return
+		}
+		glog.V(2).Infof("rkt: commands retried after lock contention since start: %v", counts)
+		logged = counts
+	}, period, stop)
+}
+
+// isReadOnly returns whether a rkt command only reads pods or images, so it
+// can be run again when it fails.
+func isReadOnly(subCmd string, args []string) bool {
+	switch subCmd {
+	case "list", "status":
+		return true
+	case "app", "image":
+		return len(args) > 0 && (args[0] == "status" || args[0] == "list" || args[0] == "cat-manifest")
+	}
+	return false
+}
+
+// retryCommand runs a command until it doesn't fail because of lock
+// contention, the backoff steps are exhausted or the context is done.
+func retryCommand(ctx context.Context, subCmd string, args []string, run func() ([]string, error)) ([]string, error) {
+	name := subCmd
+	if subCmd == "app" || subCmd == "image" {
+		name = strings.Join([]string{subCmd, args[0]}, " ")
+	}
+
+	delay := retryBackoff.Duration
+	for attempt := 1; ; attempt++ {
+		output, err := run()
+		if !IsErrorKind(err, ErrLockContention) {
+			return output, err
+		}
+		if attempt == retryBackoff.Steps {
+			if rktErr, ok := err.(*Error); ok {
+				rktErr.Retries = attempt - 1
+			}
+			return output, err
+		}
+
+		sleep := wait.Jitter(delay, retryBackoff.Jitter)
+		glog.V(2).Infof("rkt: retrying %v %v in %v after lock contention (attempt %d)", subCmd, args, sleep, attempt)
+		retries.Lock()
+		retries.counts[name]++
+		retries.Unlock()
+
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return output, err
+		}
+		delay = time.Duration(float64(delay) * retryBackoff.Factor)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRetryOnLockContention(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_retry")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origBackoff := retryBackoff
+	retryBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Jitter: 0.5, Steps: 3}
+	defer func() { retryBackoff = origBackoff }()
+
+	// A fake rkt failing with lock contention until it was run as many times
+	// as $FAIL_TIMES.
+	calls := filepath.Join(tmpDir, "calls")
+	rktPath := filepath.Join(tmpDir, "rkt")
+	script := "#!/bin/sh\necho >> " + calls + "\n" +
+		"if [ $(wc -l < " + calls + ") -le $FAIL_TIMES ]; then echo 'cannot acquire lock: file already locked'; exit 254; fi\n" +
+		"echo ok\n"
+	if err := ioutil.WriteFile(rktPath, []byte(script), 0755); err != nil {
+		t.Fatalf("unable to write fake rkt: %v", err)
+	}
+	c := NewRetryingCLI(NewRktCLI(rktPath, CLIConfig{}))
+
+	countCalls := func() int {
+		data, _ := ioutil.ReadFile(calls)
+		os.Remove(calls)
+		return strings.Count(string(data), "\n")
+	}
+	retried := RetryCounts()["image list"]
+
+	os.Setenv("FAIL_TIMES", "2")
+	defer os.Unsetenv("FAIL_TIMES")
+	output, err := c.RunCommandContext(context.Background(), "image", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ok"}, output)
+	assert.Equal(t, 3, countCalls())
+	assert.Equal(t, retried+2, RetryCounts()["image list"])
+
+	// The retries are bounded.
+	os.Setenv("FAIL_TIMES", "5")
+	_, err = c.RunCommandContext(context.Background(), "image", "list")
+	assert.True(t, IsErrorKind(err, ErrLockContention))
+	if assert.IsType(t, &Error{}, err) {
+		assert.Equal(t, 2, err.(*Error).Retries)
+	}
+	assert.Equal(t, 3, countCalls())
+
+	// Commands changing pods or images aren't retried.
+	_, err = c.RunCommandContext(context.Background(), "image", "rm", "sha512-foo")
+	assert.True(t, IsErrorKind(err, ErrLockContention))
+	assert.Equal(t, 1, countCalls())
+
+	// The slot of a limited CLI is free while waiting to retry.
+	retryBackoff = wait.Backoff{Duration: 500 * time.Millisecond, Factor: 1, Jitter: 0.5, Steps: 2}
+	limited := NewLimitedCLI(NewRktCLI(rktPath, CLIConfig{}), 1)
+	c = NewRetryingCLI(limited)
+	os.Setenv("FAIL_TIMES", "1")
+	done := make(chan error)
+	go func() {
+		_, err := c.RunCommandContext(context.Background(), "image", "list")
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = limited.RunCommandContext(ctx, "version")
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, countCalls())
+}
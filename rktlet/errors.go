@@ -0,0 +1,35 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rktlet
+
+import (
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ErrorCodeInterceptor gives the errors returned by the runtime and image
+// services the gRPC code matching their cause, e.g. NotFound when rkt didn't
+// find a pod, or DeadlineExceeded when a rkt command timed out, so the kubelet
+// can tell them apart. It must be installed on the gRPC server serving them.
+func ErrorCodeInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, cli.GRPCError(err)
+	}
+	return resp, nil
+}
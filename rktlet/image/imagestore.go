@@ -17,11 +17,11 @@ limitations under the License.
 package image
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,7 +29,6 @@ import (
 	"github.com/kubernetes-incubator/rktlet/rktlet/util"
 
 	appcschema "github.com/appc/spec/schema"
-	rktlib "github.com/rkt/rkt/api/v1"
 	context "golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
@@ -41,21 +40,86 @@ var (
 
 // var _ kubeletApi.ImageManagerService = (*ImageStore)(nil)
 
+// defaultFsInfoRefreshPeriod is how long the image filesystem usage is cached
+// for, unless configured otherwise.
+const defaultFsInfoRefreshPeriod = time.Minute
+
+// defaultImageListRefreshPeriod is how often the images are relisted, unless
+// configured otherwise. The list is also refreshed after every pull or
+// removal made through the image store.
+const defaultImageListRefreshPeriod = time.Minute
+
 // ImageStore supports CRUD operations for images.
 type ImageStore struct {
 	cli.CLI
+	// reader lists images, by running rkt or from its api-service.
+	reader         cli.Reader
 	requestTimeout time.Duration
+
+	dataDir             string
+	fsInfoRefreshPeriod time.Duration
+
+	fsInfoLock       sync.Mutex
+	fsInfo           *runtime.FilesystemUsage
+	fsInfoRefreshing bool
+
+	// imageCache holds the images served by ListImages and ImageStatus.
+	imageCache *util.ListCache
 }
 
 // TODO(tmrts): fill the image store configuration fields.
 type ImageStoreConfig struct {
-	CLI            cli.CLI
+	CLI cli.CLI
+	// Reader lists the images. If it's nil, they're listed by running rkt
+	// with CLI.
+	Reader cli.Reader
+	// RequestTimeout bounds how long an image pull may take, on top of the
+	// deadline of the request. 0 means no additional bound.
 	RequestTimeout time.Duration
+
+	// DataDir is rkt's data directory, the images are stored under it.
+	DataDir string
+	// FsInfoRefreshPeriod is how long the usage reported by ImageFsInfo is
+	// cached for. Measuring it requires walking the whole store.
+	FsInfoRefreshPeriod time.Duration
+	// ListRefreshPeriod is how often the images are relisted from rkt. In
+	// between, ListImages and ImageStatus are served from a cache.
+	ListRefreshPeriod time.Duration
 }
 
 // NewImageStore creates an image storage that allows CRUD operations for images.
 func NewImageStore(cfg ImageStoreConfig) runtime.ImageServiceServer {
-	return &ImageStore{cfg.CLI, cfg.RequestTimeout}
+	refreshPeriod := cfg.FsInfoRefreshPeriod
+	if refreshPeriod == 0 {
+		refreshPeriod = defaultFsInfoRefreshPeriod
+	}
+
+	listRefreshPeriod := cfg.ListRefreshPeriod
+	if listRefreshPeriod == 0 {
+		listRefreshPeriod = defaultImageListRefreshPeriod
+	}
+
+	reader := cfg.Reader
+	if reader == nil {
+		reader = cli.NewCLIReader(cfg.CLI)
+	}
+
+	s := &ImageStore{
+		CLI:                 cfg.CLI,
+		reader:              reader,
+		requestTimeout:      cfg.RequestTimeout,
+		dataDir:             cfg.DataDir,
+		fsInfoRefreshPeriod: refreshPeriod,
+	}
+	s.imageCache = util.NewListCache(s.rktListImages, listRefreshPeriod)
+	go s.imageCache.Run()
+	return s
+}
+
+// InvalidateImageCache makes the next list of images reflect images fetched
+// or removed without going through the image store.
+func (s *ImageStore) InvalidateImageCache() {
+	s.imageCache.Invalidate()
 }
 
 // Remove removes the image from the image store.
@@ -65,11 +129,17 @@ func (s *ImageStore) RemoveImage(ctx context.Context, req *runtime.RemoveImageRe
 		return nil, err
 	}
 	if img.Image == nil {
-		return nil, fmt.Errorf("Image does not exist")
+		// Removing is idempotent.
+		return &runtime.RemoveImageResponse{}, nil
 	}
 
-	if output, err := s.RunCommand("image", "rm", img.Image.Id); err != nil {
-		return nil, fmt.Errorf("failed to remove the image, output: %s\nerr: %v", output, err)
+	output, err := s.RunCommandContext(ctx, "image", "rm", img.Image.Id)
+	s.imageCache.Invalidate()
+	if cli.IsErrorKind(err, cli.ErrImageNotFound) {
+		return &runtime.RemoveImageResponse{}, nil
+	}
+	if err != nil {
+		return nil, cli.WrapError(err, "failed to remove the image, output: %s\n", output)
 	}
 
 	return &runtime.RemoveImageResponse{}, nil
@@ -112,28 +182,35 @@ func (s *ImageStore) ImageStatus(ctx context.Context, req *runtime.ImageStatusRe
 
 // ListImages lists images in the store
 func (s *ImageStore) ListImages(ctx context.Context, req *runtime.ListImagesRequest) (*runtime.ListImagesResponse, error) {
-	list, err := s.RunCommand("image", "list",
-		"--full",
-		"--format=json",
-		"--sort=importtime",
-	)
+	list, err := s.imageCache.Get(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't list images: %v", err)
+		return nil, err
 	}
 
-	listEntries := []rktlib.ImageListEntry{}
+	images := []*runtime.Image{}
+	for _, image := range list.([]*runtime.Image) {
+		if passFilter(image, req.Filter) {
+			images = append(images, image)
+		}
+	}
+
+	return &runtime.ListImagesResponse{Images: images}, nil
+}
 
-	err = json.Unmarshal([]byte(list[0]), &listEntries)
+// rktListImages lists all the images in rkt's store, along with their
+// manifest.
+func (s *ImageStore) rktListImages(ctx context.Context) (interface{}, error) {
+	listEntries, err := s.reader.ListImages(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal images into expected format: %v", err)
+		return nil, cli.WrapError(err, "couldn't list images")
 	}
 
-	images := make([]*runtime.Image, 0, len(list))
+	images := make([]*runtime.Image, 0, len(listEntries))
 	for i, _ := range listEntries {
 		img := listEntries[i]
 
 		var realName, user string
-		manifest, err := s.getImageManifest(img.ID)
+		manifest, err := s.getImageManifest(ctx, img.ID)
 		if err != nil {
 			glog.Warningf("unable to get image %q manifest: %v", img.ID, err)
 			realName = img.Name
@@ -156,31 +233,73 @@ func (s *ImageStore) ListImages(ctx context.Context, req *runtime.ListImagesRequ
 			image.Username = user
 		}
 
-		if passFilter(image, req.Filter) {
-			images = append(images, image)
-		}
+		images = append(images, image)
 	}
 
-	return &runtime.ListImagesResponse{Images: images}, nil
+	return images, nil
 }
 
 // ImageFSInfo returns information of the filesystem that is used to store images.
+// The usage is measured at most once per refresh period; in between, the
+// last measurement is returned while a new one is taken in the background.
 func (s *ImageStore) ImageFsInfo(ctx context.Context, req *runtime.ImageFsInfoRequest) (*runtime.ImageFsInfoResponse, error) {
-	return nil, fmt.Errorf("not implemented")
+	s.fsInfoLock.Lock()
+	defer s.fsInfoLock.Unlock()
+
+	if s.fsInfo == nil {
+		fsInfo, err := s.measureImageFs()
+		if err != nil {
+			return nil, err
+		}
+		s.fsInfo = fsInfo
+	} else if !s.fsInfoRefreshing && time.Since(time.Unix(0, s.fsInfo.Timestamp)) > s.fsInfoRefreshPeriod {
+		s.fsInfoRefreshing = true
+		go s.refreshImageFs()
+	}
+
+	return &runtime.ImageFsInfoResponse{
+		ImageFilesystems: []*runtime.FilesystemUsage{s.fsInfo},
+	}, nil
 }
 
-func (s *ImageStore) getImageManifest(id string) (*appcschema.ImageManifest, error) {
-	imgManifest, err := s.RunCommand("image", "cat-manifest", id)
+func (s *ImageStore) refreshImageFs() {
+	fsInfo, err := s.measureImageFs()
+
+	s.fsInfoLock.Lock()
+	defer s.fsInfoLock.Unlock()
+
+	s.fsInfoRefreshing = false
 	if err != nil {
-		return nil, err
+		glog.Warningf("unable to refresh image filesystem usage: %v", err)
+		return
 	}
-	var manifest appcschema.ImageManifest
+	s.fsInfo = fsInfo
+}
+
+// measureImageFs walks rkt's CAS and tree store, which hold all the images.
+func (s *ImageStore) measureImageFs() (*runtime.FilesystemUsage, error) {
+	storeDir := filepath.Join(s.dataDir, "cas")
 
-	err = json.Unmarshal([]byte(strings.Join(imgManifest, "")), &manifest)
+	bytes, inodes, err := util.DiskUsage(storeDir)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to measure the image store %q: %v", storeDir, err)
+	}
+
+	fsUUID, err := util.FsUUID(storeDir)
+	if err != nil {
+		glog.Warningf("unable to find the filesystem UUID of %q: %v", storeDir, err)
 	}
-	return &manifest, nil
+
+	return &runtime.FilesystemUsage{
+		Timestamp:  time.Now().UnixNano(),
+		StorageId:  &runtime.StorageIdentifier{Uuid: fsUUID},
+		UsedBytes:  &runtime.UInt64Value{Value: bytes},
+		InodesUsed: &runtime.UInt64Value{Value: inodes},
+	}, nil
+}
+
+func (s *ImageStore) getImageManifest(ctx context.Context, id string) (*appcschema.ImageManifest, error) {
+	return s.reader.InspectImage(ctx, id)
 }
 
 func (s *ImageStore) getImageRealName(manifest *appcschema.ImageManifest, default_ string) string {
@@ -217,10 +336,17 @@ func (s *ImageStore) PullImage(ctx context.Context, req *runtime.PullImageReques
 		return nil, fmt.Errorf("unable to default tag for img %q, %v", req.Image.Image, err)
 	}
 
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+
 	// TODO auth
-	output, err := s.RunCommand("image", "fetch", "--pull-policy=update", "--full=true", canonicalImageName)
+	output, err := s.RunCommandContext(ctx, "image", "fetch", "--pull-policy=update", "--full=true", canonicalImageName)
+	s.imageCache.Invalidate()
 	if err != nil {
-		return nil, fmt.Errorf("unable to fetch image %q\noutput: %s\nerr: %v", canonicalImageName, output, err)
+		return nil, cli.WrapError(err, "unable to fetch image %q\noutput: %s\n", canonicalImageName, output)
 	}
 	if len(output) < 1 {
 		return nil, fmt.Errorf("malformed fetch image response for %q; must include image id: %v", canonicalImageName, output)
@@ -18,6 +18,9 @@ package image
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -42,10 +45,10 @@ func TestPullImage(t *testing.T) {
 
 	mockImageStore := NewImageStore(ImageStoreConfig{CLI: mockCli, RequestTimeout: 0 * time.Second})
 
-	mockCli.On("RunCommand", "image", mock.AnythingOfType("[]string")).Run(func(args mock.Arguments) {
-		cmdArgs, ok := args.Get(1).([]string)
+	mockCli.On("RunCommandContext", mock.Anything, "image", mock.AnythingOfType("[]string")).Run(func(args mock.Arguments) {
+		cmdArgs, ok := args.Get(2).([]string)
 		if !ok {
-			t.Fatalf("Expected type []string, got type %v", reflect.TypeOf(args.Get(1)))
+			t.Fatalf("Expected type []string, got type %v", reflect.TypeOf(args.Get(2)))
 		}
 		subCommand := cmdArgs[0]
 		image := cmdArgs[len(cmdArgs)-1]
@@ -120,3 +123,43 @@ func TestPassFilter(t *testing.T) {
 		assert.Equal(t, tt.result, passFilter(tt.image, tt.filter), testHint)
 	}
 }
+
+func TestImageFsInfo(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "rktlet_imagefs")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	blobDir := filepath.Join(dataDir, "cas", "blob", "sha512")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		t.Fatalf("unable to create %q: %v", blobDir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blobDir, "aaa"), []byte("image"), 0644); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+
+	imageStore := NewImageStore(ImageStoreConfig{CLI: new(mocks.CLI), DataDir: dataDir, FsInfoRefreshPeriod: time.Hour})
+
+	resp, err := imageStore.ImageFsInfo(context.Background(), &runtime.ImageFsInfoRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resp.ImageFilesystems) != 1 {
+		t.Fatalf("Expected 1 image filesystem, got %v", resp.ImageFilesystems)
+	}
+	fsInfo := resp.ImageFilesystems[0]
+	// cas, blob, sha512 and aaa
+	assert.Equal(t, uint64(4), fsInfo.GetInodesUsed().GetValue())
+	assert.NotZero(t, fsInfo.Timestamp)
+
+	// The result is cached until the refresh period expires.
+	if err := ioutil.WriteFile(filepath.Join(blobDir, "bbb"), []byte("image"), 0644); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+	resp, err = imageStore.ImageFsInfo(context.Background(), &runtime.ImageFsInfoRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert.Equal(t, fsInfo, resp.ImageFilesystems[0])
+}
@@ -21,10 +21,13 @@ package rktlet
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
 	"github.com/kubernetes-incubator/rktlet/rktlet/image"
 	"github.com/kubernetes-incubator/rktlet/rktlet/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	runtimeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 	"k8s.io/utils/exec"
 )
@@ -44,25 +47,46 @@ func New(config *Config) (ContainerAndImageService, error) {
 		return nil, fmt.Errorf("rkt binary did not exist at %q: %v", config.RktPath, err)
 	}
 
-	systemdRunPath, err := execer.LookPath("systemd-run")
-	if err != nil {
-		return nil, fmt.Errorf("must have systemd-run installed: %v", err)
-	}
-
-	rktCli := cli.NewRktCLI(config.RktPath, execer, cli.CLIConfig{
+	rktCli := cli.NewRktCLI(config.RktPath, cli.CLIConfig{
 		InsecureOptions: []string{"image", "ondisk"},
 		Dir:             config.RktDatadir,
+		LocalConfigDir:  config.RktLocalConfigDir,
 	})
-	init := cli.NewSystemd(systemdRunPath, execer)
+	rktCli = cli.NewLimitedCLI(rktCli, config.MaxConcurrentRktCommands)
+	// Retrying above the limit frees the slot while waiting to retry.
+	rktCli = cli.NewRetryingCLI(rktCli)
+	go cli.LogRetryCounts(time.Minute, wait.NeverStop)
+	rktReader := cli.NewCLIReader(rktCli)
+	if config.RktAPIEndpoint != "" {
+		var err error
+		rktReader, err = cli.NewAPIServiceReader(config.RktAPIEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	init, err := newInit(config, execer)
+	if err != nil {
+		return nil, err
+	}
 
-	imageStore := image.NewImageStore(image.ImageStoreConfig{CLI: rktCli})
+	imageStore := image.NewImageStore(image.ImageStoreConfig{
+		CLI:     rktCli,
+		Reader:  rktReader,
+		DataDir: config.RktDatadir,
+	})
 
 	rktRuntime, err := runtime.New(rktCli,
+		rktReader,
 		init,
 		imageStore,
 		config.StreamServerAddress,
 		config.RktStage1Name,
-		config.NetworkPluginName)
+		config.NetworkPluginName,
+		config.RktLocalConfigDir,
+		config.RktDatadir,
+		config.ExecOutputLimit,
+		config.StateCacheRefreshPeriod,
+		config.PodReadyTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +97,81 @@ func New(config *Config) (ContainerAndImageService, error) {
 	}, nil
 }
 
+// The init systems running pod sandboxes.
+const (
+	// InitSystemd runs pod sandboxes in transient units of systemd, created
+	// over D-Bus if possible and with systemd-run otherwise.
+	InitSystemd = "systemd"
+	// InitProcess runs pod sandboxes as detached children of rktlet, for
+	// hosts without systemd.
+	InitProcess = "process"
+)
+
+// newInit returns the Init running pod sandboxes with the configured init
+// system. If none is configured, systemd is used if the host was booted with
+// it and its tools are installed.
+func newInit(config *Config, execer exec.Interface) (cli.Init, error) {
+	if err := cli.ValidateCgroupDriver(config.CgroupDriver); err != nil {
+		return nil, err
+	}
+
+	// The units of systemd can't be placed in the cgroup parents of the
+	// cgroupfs driver in the hierarchy of systemd, where the stage1 reads
+	// the cgroup to place the apps in from.
+	cgroupfs := config.CgroupDriver == cli.CgroupDriverCgroupfs
+
+	switch config.Init {
+	case InitSystemd:
+		if cgroupfs {
+			return nil, fmt.Errorf("the %q cgroup driver requires the %q init system", cli.CgroupDriverCgroupfs, InitProcess)
+		}
+		return newSystemdInit(config, execer)
+	case InitProcess:
+		return cli.NewProcessInit(config.ProcessInitDir), nil
+	case "":
+		if cgroupfs {
+			glog.Infof("rkt: using the %q cgroup driver, running pod sandboxes as children of rktlet", cli.CgroupDriverCgroupfs)
+			return cli.NewProcessInit(config.ProcessInitDir), nil
+		}
+		if !cli.SystemdBooted() {
+			glog.Infof("rkt: host not booted with systemd, running pod sandboxes as children of rktlet")
+			return cli.NewProcessInit(config.ProcessInitDir), nil
+		}
+		init, err := newSystemdInit(config, execer)
+		if err != nil {
+			glog.Warningf("rkt: %v, running pod sandboxes as children of rktlet", err)
+			return cli.NewProcessInit(config.ProcessInitDir), nil
+		}
+		return init, nil
+	}
+	return nil, fmt.Errorf("unsupported init system %q, must be %q or %q", config.Init, InitSystemd, InitProcess)
+}
+
+// newSystemdInit returns the Init running pod sandboxes in transient units of
+// systemd, created over D-Bus if possible and with systemd-run otherwise.
+func newSystemdInit(config *Config, execer exec.Interface) (cli.Init, error) {
+	systemdConfig := cli.SystemdConfig{
+		ReadyTimeout: config.PodReadyTimeout,
+	}
+
+	init, err := cli.NewSystemdDBus(systemdConfig, execer)
+	if err == nil {
+		return init, nil
+	}
+	glog.Warningf("rkt: %v, falling back to systemd-run", err)
+
+	systemdRunPath, err := execer.LookPath("systemd-run")
+	if err != nil {
+		return nil, fmt.Errorf("must have systemd-run installed: %v", err)
+	}
+	systemctlPath, err := execer.LookPath("systemctl")
+	if err != nil {
+		return nil, fmt.Errorf("must have systemctl installed: %v", err)
+	}
+
+	return cli.NewSystemd(systemdRunPath, systemctlPath, systemdConfig, execer), nil
+}
+
 type Config struct {
 	RktDatadir    string
 	RktPath       string
@@ -84,13 +183,58 @@ type Config struct {
 	StreamServerAddress string
 
 	NetworkPluginName string
+	// RktLocalConfigDir is the local configuration directory of rkt. rkt
+	// loads CNI network configurations from its 'net.d' subdirectory.
+	RktLocalConfigDir string
+
+	// ExecOutputLimit is the maximum number of bytes of stdout, and of stderr,
+	// kept from commands run with ExecSync, e.g. for exec probes. 0 means no
+	// limit.
+	ExecOutputLimit int64
+
+	// StateCacheRefreshPeriod is how often the pods and containers are
+	// relisted from rkt. In between, the list calls are served from a cache
+	// that is also refreshed after every change made by rktlet.
+	StateCacheRefreshPeriod time.Duration
+
+	// RktAPIEndpoint is the address of a rkt api-service. If set, pods and
+	// images are read from it rather than by running rkt.
+	RktAPIEndpoint string
+
+	// CgroupDriver is the cgroup driver of the kubelet, which defines the
+	// format of the cgroup parents of pods: cli.CgroupDriverSystemd or
+	// cli.CgroupDriverCgroupfs.
+	CgroupDriver string
+
+	// Init is the init system running pod sandboxes, InitSystemd or
+	// InitProcess. If it's empty, systemd is used when available.
+	Init string
+	// ProcessInitDir is where InitProcess keeps the state and the output of
+	// pod sandboxes.
+	ProcessInitDir string
+
+	// PodReadyTimeout is how long to wait for a new pod sandbox to be ready
+	// before failing to run it.
+	PodReadyTimeout time.Duration
+
+	// MaxConcurrentRktCommands is the maximum number of rkt commands
+	// changing pods or images, and of those only reading them, run at once.
+	// The others wait for one to complete. 0 means no limit.
+	MaxConcurrentRktCommands int
 
 	// TODO, podcidr, networkdir, etc for cni
 }
 
 var DefaultConfig = &Config{
-	RktDatadir:          "/var/lib/rktlet/data",
-	StreamServerAddress: "0.0.0.0:10241",
+	RktDatadir:               "/var/lib/rktlet/data",
+	RktLocalConfigDir:        "/etc/rkt",
+	StreamServerAddress:      "0.0.0.0:10241",
+	ExecOutputLimit:          1024 * 1024,
+	StateCacheRefreshPeriod:  runtime.DefaultStateCacheRefreshPeriod,
+	CgroupDriver:             cli.CgroupDriverSystemd,
+	ProcessInitDir:           "/var/lib/rktlet/sandboxes",
+	PodReadyTimeout:          runtime.DefaultPodReadyTimeout,
+	MaxConcurrentRktCommands: 16,
 }
 
 type ContainerAndImageService interface {
@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+)
+
+// podDir returns the directory rkt uses for a running pod.
+func (r *RktRuntime) podDir(uuid string) string {
+	return podDir(r.dataDir, uuid)
+}
+
+func podDir(dataDir, uuid string) string {
+	return filepath.Join(dataDir, "pods", "run", uuid)
+}
+
+// appCgroupPath returns the cgroup of the given app, relative to the root of
+// a cgroup hierarchy.
+//
+// The stage1 writes the cgroup it runs in (for rktlet, the one of the
+// transient unit inside the pod's slice) to the 'subcgroup' file of the pod
+// directory. Each app is then a service of the systemd running inside the
+// pod, e.g.:
+//   kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod<uid>.slice/rktlet-<id>.service/system.slice/<app>.service
+// or, with the cgroupfs driver, where the stage1 runs in the pod's cgroup in
+// every hierarchy:
+//   kubepods/besteffort/pod<uid>/<cgroup of the stage1>/system.slice/<app>.service
+func (r *RktRuntime) appCgroupPath(uuid, appName string) (string, error) {
+	subcgroup, err := ioutil.ReadFile(filepath.Join(r.podDir(uuid), "subcgroup"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(strings.TrimSpace(string(subcgroup)), "system.slice", appName+".service"), nil
+}
+
+// appPids returns the pids of the processes in the cgroup of an app.
+func (r *RktRuntime) appPids(uuid, appName string) ([]int, error) {
+	cgroupPath, err := r.appCgroupPath(uuid, appName)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := ioutil.ReadFile(filepath.Join(util.CgroupRoot, "memory", cgroupPath, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(procs)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q in cgroup %q", field, cgroupPath)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// readCgroupUint64 reads a file of a cgroup that holds a single integer, such
+// as 'memory.usage_in_bytes'.
+func readCgroupUint64(controller, cgroupPath, file string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(util.CgroupRoot, controller, cgroupPath, file))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// writeCgroupFile writes a value into a file of a cgroup, such as
+// 'memory.limit_in_bytes'.
+func writeCgroupFile(controller, cgroupPath, file, value string) error {
+	return ioutil.WriteFile(filepath.Join(util.CgroupRoot, controller, cgroupPath, file), []byte(value), 0644)
+}
+
+// readCgroupKeyedFile reads a flat keyed file of a cgroup, such as
+// 'memory.stat'.
+func readCgroupKeyedFile(controller, cgroupPath, file string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(util.CgroupRoot, controller, cgroupPath, file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for %q in %s: %v", fields[1], fields[0], file, err)
+		}
+		values[fields[0]] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// subcgroupScript writes the cgroup the shell is in, in the hierarchy of
+// systemd given as first argument, to the file given as second argument,
+// like the stage1 does with the 'subcgroup' file of the pod.
+const subcgroupScript = `for f in $(find "$1" -name cgroup.procs); do if grep -qx $$ "$f"; then d=$(dirname "$f"); echo "${d#$1/}"; fi; done > "$2"`
+
+func TestAppCgroupPathCgroupfs(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_cgroups")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+	for _, hierarchy := range []string{"memory", "systemd"} {
+		mkdir(t, filepath.Join(util.CgroupRoot, hierarchy))
+	}
+
+	r := &RktRuntime{dataDir: filepath.Join(tmpDir, "data")}
+	mkdir(t, r.podDir("1234"))
+
+	// The sandbox is run in the cgroup parent by the process init, which
+	// the cgroupfs driver requires.
+	cgroupParent := "/kubepods/besteffort/pod1234"
+	init := cli.NewProcessInit(filepath.Join(tmpDir, "sandboxes"))
+	id, err := init.StartProcess(cgroupParent, "/bin/sh", "-c", subcgroupScript, "sh", filepath.Join(util.CgroupRoot, "systemd"), filepath.Join(r.podDir("1234"), "subcgroup"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if status, err := init.ProcessStatus(id); err != nil || !status.Running {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.NoError(t, init.RemoveProcess(id))
+
+	appCgroup, err := r.appCgroupPath("1234", "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "kubepods/besteffort/pod1234/system.slice/foo.service", appCgroup)
+	assert.True(t, strings.HasPrefix("/"+appCgroup, cgroupParent+"/"), "app cgroup %q not under %q", appCgroup, cgroupParent)
+}
@@ -19,9 +19,12 @@ package runtime
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/kr/pty"
@@ -29,6 +32,8 @@ import (
 	utilexec "k8s.io/utils/exec"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 
 	"k8s.io/client-go/tools/remotecommand"
 	runtimeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
@@ -46,11 +51,15 @@ func (r *RktRuntime) Exec(ctx context.Context, req *runtimeapi.ExecRequest) (*ru
 }
 
 func (r *RktRuntime) ExecSync(ctx context.Context, req *runtimeapi.ExecSyncRequest) (*runtimeapi.ExecSyncResponse, error) {
-	var stdout, stderr bytes.Buffer
+	stdout := &limitedBuffer{limit: r.execOutputLimit}
+	stderr := &limitedBuffer{limit: r.execOutputLimit}
 
-	// TODO: Respect req.Timeout
 	exitCode := int32(0)
-	err := r.execShim.Exec(req.ContainerId, req.Cmd, nil, ioutils.WriteCloserWrapper(&stdout), ioutils.WriteCloserWrapper(&stderr), false, nil)
+	timeout := time.Duration(req.Timeout) * time.Second
+	err := r.execShim.execWithTimeout(req.ContainerId, req.Cmd, nil, ioutils.WriteCloserWrapper(stdout), ioutils.WriteCloserWrapper(stderr), false, nil, timeout)
+	if err == errExecTimeout {
+		return nil, grpcstatus.Errorf(codes.DeadlineExceeded, "command %v in container %q timed out after %v", req.Cmd, req.ContainerId, timeout)
+	}
 	exitErr, ok := err.(utilexec.ExitError)
 	if ok {
 		exitCode = int32(exitErr.ExitStatus())
@@ -72,22 +81,95 @@ func (r *RktRuntime) PortForward(ctx context.Context, req *runtimeapi.PortForwar
 	return r.streamServer.GetPortForward(req)
 }
 
+// errExecTimeout is returned when a command executed with a timeout had to be
+// killed.
+var errExecTimeout = errors.New("exec timed out")
+
 type execShim struct {
-	cli cli.CLI
+	cli     cli.CLI
+	dataDir string
 }
 
 var _ streaming.Runtime = &execShim{}
 
-func NewExecShim(cli cli.CLI) *execShim {
-	return &execShim{cli: cli}
+func NewExecShim(cli cli.CLI, dataDir string) *execShim {
+	return &execShim{cli: cli, dataDir: dataDir}
+}
+
+// Attach attaches to the streams of a running container, through rkt's
+// attach support.
+func (es *execShim) Attach(containerID string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	uuid, appName, err := parseContainerID(containerID)
+	if err != nil {
+		return err
+	}
+
+	mode, err := attachMode(in != nil, out != nil, errOut != nil, tty)
+	if err != nil {
+		return err
+	}
+	rktCommand := es.cli.Command("attach", "--app="+appName, "--mode="+mode, uuid)
+	attachCmd := exec.Command(rktCommand[0], rktCommand[1:]...)
+	glog.V(5).Infof("attaching: %v", attachCmd.Args)
+
+	if tty {
+		return execWithTty(attachCmd, in, out, resize)
+	}
+
+	if in != nil {
+		attachCmd.Stdin = in
+	}
+	attachCmd.Stdout = out
+	attachCmd.Stderr = errOut
+
+	if err := attachCmd.Run(); err != nil {
+		glog.Warningf("error running attach: %v", err)
+		return newRktExitError(err)
+	}
+	return nil
 }
 
-func (es *execShim) Attach(containerID string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
-	return errors.New("TODO")
+// attachMode returns the value of the `--mode` flag of `rkt attach` for the
+// requested streams. With a tty, stderr is part of the output of the tty, so
+// stdin or stdout must be requested.
+func attachMode(stdin, stdout, stderr, tty bool) (string, error) {
+	var modes []string
+	if tty {
+		if stdin {
+			modes = append(modes, "tty-in")
+		}
+		if stdout {
+			modes = append(modes, "tty-out")
+		}
+		if len(modes) == 2 {
+			return "tty", nil
+		}
+	} else {
+		if stdin {
+			modes = append(modes, "stdin")
+		}
+		if stdout {
+			modes = append(modes, "stdout")
+		}
+		if stderr {
+			modes = append(modes, "stderr")
+		}
+	}
+	if len(modes) == 0 {
+		return "", fmt.Errorf("no stream to attach to (stdin: %t, stdout: %t, stderr: %t, tty: %t)", stdin, stdout, stderr, tty)
+	}
+	return strings.Join(modes, ","), nil
 }
 
 // Exec executes a given command in a container
 func (es *execShim) Exec(containerID string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	return es.execWithTimeout(containerID, cmd, in, out, errOut, tty, resize, 0)
+}
+
+// execWithTimeout executes a given command in a container. If timeout is not
+// 0 and expires before the command finishes, the command and all its children
+// are killed and errExecTimeout is returned.
+func (es *execShim) execWithTimeout(containerID string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
 	uuid, appName, err := parseContainerID(containerID)
 	if err != nil {
 		return err
@@ -110,13 +192,34 @@ func (es *execShim) Exec(containerID string, cmd []string, in io.Reader, out, er
 	}
 	execCmd.Stdout = out
 	execCmd.Stderr = errOut
+	// Run rkt in its own process group. The command entered in the pod stays
+	// in it, so the whole tree can be killed at once.
+	execCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	if err := execCmd.Start(); err != nil {
 		glog.Warningf("error running exec: %v", err)
 		return err
 	}
 
+	var timedOut chan struct{}
+	if timeout > 0 {
+		timedOut = make(chan struct{})
+		timer := time.AfterFunc(timeout, func() {
+			close(timedOut)
+			glog.V(4).Infof("exec %v timed out after %v, killing it", execCmd.Args, timeout)
+			if err := syscall.Kill(-execCmd.Process.Pid, syscall.SIGKILL); err != nil {
+				glog.Warningf("error killing exec %v: %v", execCmd.Args, err)
+			}
+		})
+		defer timer.Stop()
+	}
+
 	if err := execCmd.Wait(); err != nil {
+		select {
+		case <-timedOut:
+			return errExecTimeout
+		default:
+		}
 		glog.Warningf("error waiting for exec: %v", err)
 		return newRktExitError(err)
 	}
@@ -157,8 +260,26 @@ func execWithTty(execCmd *exec.Cmd, in io.Reader, out io.WriteCloser, resize <-c
 	return newRktExitError(execCmd.Wait())
 }
 
-func (es *execShim) PortForward(sandboxID string, port int32, stream io.ReadWriteCloser) error {
-	return errors.New("TODO")
+// limitedBuffer is a bytes.Buffer which silently discards anything written
+// past its limit, so a command can't make rktlet buffer unbounded output.
+// A limit of 0 means no limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		if room := b.limit - int64(b.Len()); int64(len(p)) > room {
+			if room > 0 {
+				b.Buffer.Write(p[:room])
+			}
+			// Pretend everything was written, so the command doesn't fail on
+			// a short write.
+			return len(p), nil
+		}
+	}
+	return b.Buffer.Write(p)
 }
 
 // rktExitError implements k8s.io/kubernetes/pkg/util/exec.ExitError interface.
@@ -0,0 +1,121 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestExecSync(t *testing.T) {
+	testCases := []struct {
+		command     []string
+		timeout     int64
+		outputLimit int64
+
+		stdout   string
+		stderr   string
+		exitCode int32
+		code     codes.Code
+	}{
+		{
+			command:  []string{"sh", "-c", "echo out; echo err >&2; exit 3"},
+			stdout:   "out\n",
+			stderr:   "err\n",
+			exitCode: 3,
+		},
+		{
+			command:     []string{"sh", "-c", "echo 0123456789; echo 0123456789 >&2"},
+			outputLimit: 4,
+			stdout:      "0123",
+			stderr:      "0123",
+		},
+		{
+			// The child of the shell must be killed too, or it would keep
+			// stdout open and Wait would block.
+			command: []string{"sh", "-c", "sleep 100; echo done"},
+			timeout: 1,
+			code:    codes.DeadlineExceeded,
+		},
+	}
+
+	for i, testCase := range testCases {
+		mockCli := new(mocks.CLI)
+		mockCli.On("Command", "app", mock.Anything).Return(testCase.command)
+		r := &RktRuntime{
+			CLI:             mockCli,
+			execShim:        NewExecShim(mockCli, ""),
+			execOutputLimit: testCase.outputLimit,
+		}
+
+		start := time.Now()
+		resp, err := r.ExecSync(context.TODO(), &runtimeApi.ExecSyncRequest{
+			ContainerId: "1234:0-foo",
+			Cmd:         []string{"true"},
+			Timeout:     testCase.timeout,
+		})
+		if testCase.code != codes.OK {
+			assert.Equal(t, testCase.code, grpc.Code(err), "test case %d", i)
+			assert.True(t, time.Since(start) < 10*time.Second, "test case %d: exec wasn't killed on time", i)
+			continue
+		}
+		if err != nil {
+			t.Errorf("test case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		assert.Equal(t, testCase.stdout, string(resp.Stdout), "test case %d", i)
+		assert.Equal(t, testCase.stderr, string(resp.Stderr), "test case %d", i)
+		assert.Equal(t, testCase.exitCode, resp.ExitCode, "test case %d", i)
+	}
+}
+
+func TestAttachMode(t *testing.T) {
+	tests := []struct {
+		stdin, stdout, stderr, tty bool
+		result                     string
+		err                        bool
+	}{
+		{true, true, true, false, "stdin,stdout,stderr", false},
+		{false, true, true, false, "stdout,stderr", false},
+		{false, true, false, false, "stdout", false},
+		{true, true, false, true, "tty", false},
+		{false, true, false, true, "tty-out", false},
+		{true, false, false, true, "tty-in", false},
+		{false, false, true, true, "", true},
+		{false, false, false, false, "", true},
+	}
+
+	for i, tt := range tests {
+		mode, err := attachMode(tt.stdin, tt.stdout, tt.stderr, tt.tty)
+		if tt.err {
+			assert.Error(t, err, "test case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "test case #%d", i)
+		assert.Equal(t, tt.result, mode, "test case #%d", i)
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	actypes "github.com/appc/spec/schema/types"
 	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
 	"github.com/pborman/uuid"
 	rkt "github.com/rkt/rkt/api/v1"
 	"github.com/rkt/rkt/networking/netinfo"
@@ -248,15 +249,13 @@ func generateAppAddCommand(req *runtimeApi.CreateContainerRequest, imageID strin
 		"add",
 		req.PodSandboxId,
 		imageID,
-		fmt.Sprintf("--annotation=coreos.com/rkt/experiment/kubernetes-log-path=%s", logPath),
+		fmt.Sprintf("--annotation=%s=%s", kubernetesLogPathAnno, logPath),
 	}
 
 	// Add app name
 	cmd = append(cmd, "--name="+appName)
 
-	cmd = append(cmd, "--stdin=stream")
-	cmd = append(cmd, "--stdout=stream")
-	cmd = append(cmd, "--stderr=stream")
+	cmd = append(cmd, generateStreamArgs(config)...)
 
 	// Add annotations and labels.
 	for _, anno := range annotations {
@@ -392,6 +391,24 @@ func generateAppAddCommand(req *runtimeApi.CreateContainerRequest, imageID strin
 	return cmd, nil
 }
 
+// generateStreamArgs returns the arguments setting up how the stdin, stdout
+// and stderr of an app are handled by rkt's iottymux, which is what
+// `rkt attach` connects to.
+// rkt has no way to close the stdin of an app once the first attach session
+// ends, so StdinOnce is handled like Stdin.
+func generateStreamArgs(config *runtimeApi.ContainerConfig) []string {
+	if config.Tty {
+		// rkt requires all the streams to be on the tty if one of them is.
+		return []string{"--stdin=tty", "--stdout=tty", "--stderr=tty"}
+	}
+
+	stdin := "null"
+	if config.Stdin {
+		stdin = "stream"
+	}
+	return []string{"--stdin=" + stdin, "--stdout=stream", "--stderr=stream"}
+}
+
 // maybeCreateHostPathVolume creates the source dir for Mount if it doesn't
 // exist since rkt doesn't do it. It returns whether the dir was created.
 func maybeCreateHostPathVolume(mount *runtimeApi.Mount) (created bool, err error) {
@@ -424,7 +441,7 @@ func generateAppSandboxCommand(req *runtimeApi.RunPodSandboxRequest, uuidfile, s
 	}
 
 	cmd = append(cmd, "--annotation=coreos.com/rkt/experiment/logmode=k8s-plain")
-	cmd = append(cmd, "--annotation=coreos.com/rkt/experiment/kubernetes-log-dir="+logDirectory)
+	cmd = append(cmd, fmt.Sprintf("--annotation=%s=%s", kubernetesLogDirAnno, logDirectory))
 
 	if stage1Name != "" {
 		cmd = append(cmd, "--stage1-name="+stage1Name)
@@ -570,7 +587,7 @@ func getIP(networks []netinfo.NetInfo) string {
 
 		// Always prefer this network if available.
 		// We're done if we find it
-		if network.NetName == "rkt.kubernetes.io" {
+		if network.NetName == kubernetesNetworkName {
 			return network.IP.To4().String()
 		}
 
@@ -657,7 +674,7 @@ func (r *RktRuntime) getImageHash(ctx context.Context, imageName string) (string
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("unable to get status for image %q: %v", imageName, err)
+		return "", cli.WrapError(err, "unable to get status for image %q", imageName)
 	}
 	if resp.GetImage() == nil {
 		return "", fmt.Errorf("could not find image %q", imageName)
@@ -257,3 +257,31 @@ func TestParseContainerID(t *testing.T) {
 		assert.Equal(t, tt.resultAppName, appName, testHint)
 	}
 }
+
+func TestGenerateStreamArgs(t *testing.T) {
+	tests := []struct {
+		config *runtimeApi.ContainerConfig
+		result []string
+	}{
+		// Case 0, no stdin.
+		{
+			&runtimeApi.ContainerConfig{},
+			[]string{"--stdin=null", "--stdout=stream", "--stderr=stream"},
+		},
+		// Case 1, stdin.
+		{
+			&runtimeApi.ContainerConfig{Stdin: true, StdinOnce: true},
+			[]string{"--stdin=stream", "--stdout=stream", "--stderr=stream"},
+		},
+		// Case 2, tty.
+		{
+			&runtimeApi.ContainerConfig{Stdin: true, Tty: true},
+			[]string{"--stdin=tty", "--stdout=tty", "--stderr=tty"},
+		},
+	}
+
+	for i, tt := range tests {
+		testHint := fmt.Sprintf("test case #%d", i)
+		assert.Equal(t, tt.result, generateStreamArgs(tt.config), testHint)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// kubernetesNetworkName is the name of the network rktlet manages from
+	// the pod CIDR of the node, when pods are configured to join it.
+	kubernetesNetworkName = "rkt.kubernetes.io"
+	// kubernetesNetworkConfFile is the file, in the network configuration
+	// directory, the configuration of the managed network is written to.
+	kubernetesNetworkConfFile = "10-rkt.kubernetes.io.conf"
+	// kubernetesBridgeName is the host bridge of the managed network.
+	kubernetesBridgeName = "cbr0"
+)
+
+// bridgeNetConf is the configuration of a CNI bridge network with host-local
+// IP address management.
+type bridgeNetConf struct {
+	CNIVersion string `json:"cniVersion"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Bridge     string `json:"bridge"`
+	IsGateway  bool   `json:"isGateway"`
+	IPMasq     bool   `json:"ipMasq"`
+	IPAM       struct {
+		Type   string     `json:"type"`
+		Subnet string     `json:"subnet"`
+		Routes []cniRoute `json:"routes"`
+	} `json:"ipam"`
+}
+
+type cniRoute struct {
+	Dst string `json:"dst"`
+}
+
+// networkConfigDir returns the directory rkt loads CNI network configurations
+// from, in its local configuration directory.
+func (r *RktRuntime) networkConfigDir() string {
+	return filepath.Join(r.localConfigDir, "net.d")
+}
+
+// UpdateRuntimeConfig updates the runtime configuration sent by the kubelet.
+// When pods join the rkt.kubernetes.io network, its configuration is written
+// from the pod CIDR of the node, so no separate network daemon is needed.
+func (r *RktRuntime) UpdateRuntimeConfig(ctx context.Context, req *runtimeApi.UpdateRuntimeConfigRequest) (*runtimeApi.UpdateRuntimeConfigResponse, error) {
+	podCIDR := req.GetRuntimeConfig().GetNetworkConfig().GetPodCidr()
+	if podCIDR == "" || r.networkPluginName != kubernetesNetworkName {
+		return &runtimeApi.UpdateRuntimeConfigResponse{}, nil
+	}
+
+	if err := r.writeKubernetesNetworkConfig(podCIDR); err != nil {
+		return nil, fmt.Errorf("unable to configure network %q for pod CIDR %q: %v", kubernetesNetworkName, podCIDR, err)
+	}
+	return &runtimeApi.UpdateRuntimeConfigResponse{}, nil
+}
+
+// writeKubernetesNetworkConfig writes the configuration of the
+// rkt.kubernetes.io network for the given pod CIDR, if it changed.
+func (r *RktRuntime) writeKubernetesNetworkConfig(podCIDR string) error {
+	if _, _, err := net.ParseCIDR(podCIDR); err != nil {
+		return err
+	}
+
+	data, err := renderKubernetesNetworkConfig(podCIDR)
+	if err != nil {
+		return err
+	}
+
+	r.networkConfigLock.Lock()
+	defer r.networkConfigLock.Unlock()
+
+	netDir := r.networkConfigDir()
+	confPath := filepath.Join(netDir, kubernetesNetworkConfFile)
+	if current, err := ioutil.ReadFile(confPath); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+
+	if err := os.MkdirAll(netDir, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so rkt never reads a partial
+	// configuration. It doesn't end with .conf, so rkt ignores it.
+	tmpPath := confPath + ".rktlet"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, confPath); err != nil {
+		return err
+	}
+
+	glog.Infof("rkt: configured network %q with pod CIDR %q in %q", kubernetesNetworkName, podCIDR, confPath)
+	return nil
+}
+
+// renderKubernetesNetworkConfig returns the configuration of a bridge
+// network giving pods addresses from the pod CIDR, and masquerading their
+// traffic leaving the node.
+func renderKubernetesNetworkConfig(podCIDR string) ([]byte, error) {
+	conf := bridgeNetConf{
+		// rkt only supports CNI v0.3.0.
+		CNIVersion: "0.3.0",
+		Name:       kubernetesNetworkName,
+		Type:       "bridge",
+		Bridge:     kubernetesBridgeName,
+		IsGateway:  true,
+		IPMasq:     true,
+	}
+	conf.IPAM.Type = "host-local"
+	conf.IPAM.Subnet = podCIDR
+	conf.IPAM.Routes = []cniRoute{{Dst: "0.0.0.0/0"}}
+
+	return json.MarshalIndent(conf, "", "  ")
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestUpdateRuntimeConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_network")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	netDir := filepath.Join(tmpDir, "net.d")
+	confPath := filepath.Join(netDir, kubernetesNetworkConfFile)
+	updateRequest := func(podCIDR string) *runtimeApi.UpdateRuntimeConfigRequest {
+		return &runtimeApi.UpdateRuntimeConfigRequest{
+			RuntimeConfig: &runtimeApi.RuntimeConfig{
+				NetworkConfig: &runtimeApi.NetworkConfig{PodCidr: podCIDR},
+			},
+		}
+	}
+
+	// Pods joining another network: the pod CIDR is ignored.
+	r := &RktRuntime{networkPluginName: "flannel", localConfigDir: tmpDir}
+	_, err = r.UpdateRuntimeConfig(context.TODO(), updateRequest("10.1.2.0/24"))
+	assert.NoError(t, err)
+	_, err = os.Stat(confPath)
+	assert.True(t, os.IsNotExist(err), "unexpected network configuration: %v", err)
+
+	r = &RktRuntime{networkPluginName: kubernetesNetworkName, localConfigDir: tmpDir}
+	_, err = r.UpdateRuntimeConfig(context.TODO(), updateRequest(""))
+	assert.NoError(t, err)
+	_, err = os.Stat(confPath)
+	assert.True(t, os.IsNotExist(err), "unexpected network configuration: %v", err)
+
+	_, err = r.UpdateRuntimeConfig(context.TODO(), updateRequest("not a cidr"))
+	assert.Error(t, err)
+
+	for _, podCIDR := range []string{"10.1.2.0/24", "10.1.3.0/24"} {
+		_, err = r.UpdateRuntimeConfig(context.TODO(), updateRequest(podCIDR))
+		assert.NoError(t, err)
+
+		var conf bridgeNetConf
+		if err := json.Unmarshal([]byte(readFile(t, confPath)), &conf); err != nil {
+			t.Fatalf("invalid network configuration: %v", err)
+		}
+		assert.Equal(t, kubernetesNetworkName, conf.Name)
+		assert.Equal(t, "bridge", conf.Type)
+		assert.Equal(t, "host-local", conf.IPAM.Type)
+		assert.Equal(t, podCIDR, conf.IPAM.Subnet)
+	}
+
+	// The written configuration makes the network ready.
+	reason, err := r.checkNetworkReady()
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"golang.org/x/sys/unix"
+)
+
+// oomWatcher watches the memory cgroups of apps for OOM events. Each cgroup
+// gets an eventfd registered through cgroup.event_control, and all of them
+// are polled by a single goroutine.
+type oomWatcher struct {
+	epollFd int
+	// onOOM is called when an app ran out of memory.
+	onOOM func(uuid, appName string)
+
+	lock sync.Mutex
+	// watches are the watched apps by eventfd.
+	watches map[int]*oomWatch
+	// containers are the ids of the watched apps.
+	containers map[string]bool
+}
+
+type oomWatch struct {
+	uuid       string
+	appName    string
+	cgroupPath string
+}
+
+// newOOMWatcher creates a watcher calling onOOM when a watched app ran out of
+// memory.
+func newOOMWatcher(onOOM func(uuid, appName string)) (*oomWatcher, error) {
+	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create epoll instance: %v", err)
+	}
+	return &oomWatcher{
+		epollFd:    epollFd,
+		onOOM:      onOOM,
+		watches:    make(map[int]*oomWatch),
+		containers: make(map[string]bool),
+	}, nil
+}
+
+// watch starts watching the memory cgroup of an app, given by its path in the
+// memory hierarchy, until it's removed. It's a no-op if the app is already
+// watched.
+func (w *oomWatcher) watch(uuid, appName, cgroupPath string) error {
+	containerID := buildContainerID(uuid, appName)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.containers[containerID] {
+		return nil
+	}
+
+	eventFd, err := registerOOMEvent(filepath.Join(util.CgroupRoot, "memory", cgroupPath))
+	if err != nil {
+		return err
+	}
+	event := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(eventFd)}
+	if err := unix.EpollCtl(w.epollFd, unix.EPOLL_CTL_ADD, eventFd, &event); err != nil {
+		unix.Close(eventFd)
+		return fmt.Errorf("unable to poll eventfd: %v", err)
+	}
+
+	w.watches[eventFd] = &oomWatch{uuid: uuid, appName: appName, cgroupPath: cgroupPath}
+	w.containers[containerID] = true
+	return nil
+}
+
+// run waits for the notifications of the watched cgroups. It never returns.
+func (w *oomWatcher) run() {
+	events := make([]unix.EpollEvent, 16)
+	for {
+		n, err := unix.EpollWait(w.epollFd, events, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("rkt: unable to wait for OOM events, no longer watching: %v", err)
+			return
+		}
+		for _, event := range events[:n] {
+			w.handle(int(event.Fd))
+		}
+	}
+}
+
+// handle processes a notification on the eventfd of a watched cgroup. The
+// kernel notifies both of OOM events and of the removal of the cgroup, e.g.
+// when the app exited normally. The removal is told apart by the cgroup
+// files being gone.
+func (w *oomWatcher) handle(eventFd int) {
+	w.lock.Lock()
+	watch, ok := w.watches[eventFd]
+	w.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	// Reading resets the counter of the eventfd, so it's only notified of
+	// new events.
+	buf := make([]byte, 8)
+	if _, err := unix.Read(eventFd, buf); err != nil && err != unix.EINTR {
+		glog.Warningf("rkt: unable to read OOM events of app %q in pod %q: %v", watch.appName, watch.uuid, err)
+	}
+
+	oomControl, err := readCgroupKeyedFile("memory", watch.cgroupPath, "memory.oom_control")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("rkt: unable to read OOM state of app %q in pod %q: %v", watch.appName, watch.uuid, err)
+		}
+		w.remove(eventFd)
+		return
+	}
+	// oom_kill is only reported by Linux 4.13 and later. The notification
+	// of an existing cgroup is an OOM event on older kernels.
+	if oomKill, ok := oomControl["oom_kill"]; ok && oomKill == 0 && oomControl["under_oom"] == 0 {
+		return
+	}
+	w.onOOM(watch.uuid, watch.appName)
+}
+
+// remove stops watching the cgroup of an eventfd, and closes it.
+func (w *oomWatcher) remove(eventFd int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	watch, ok := w.watches[eventFd]
+	if !ok {
+		return
+	}
+	delete(w.watches, eventFd)
+	delete(w.containers, buildContainerID(watch.uuid, watch.appName))
+	unix.EpollCtl(w.epollFd, unix.EPOLL_CTL_DEL, eventFd, nil)
+	unix.Close(eventFd)
+}
+
+// registerOOMEvent registers an eventfd to be notified of OOM events of a
+// memory cgroup, through cgroup.event_control.
+func registerOOMEvent(cgroupDir string) (int, error) {
+	oomControl, err := os.Open(filepath.Join(cgroupDir, "memory.oom_control"))
+	if err != nil {
+		return -1, err
+	}
+	defer oomControl.Close()
+
+	eventFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return -1, fmt.Errorf("unable to create eventfd: %v", err)
+	}
+
+	control := fmt.Sprintf("%d %d", eventFd, oomControl.Fd())
+	if err := ioutil.WriteFile(filepath.Join(cgroupDir, "cgroup.event_control"), []byte(control), 0200); err != nil {
+		unix.Close(eventFd)
+		return -1, err
+	}
+	return eventFd, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	rktlib "github.com/rkt/rkt/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+func TestOOMWatcher(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_oom_watcher")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = tmpDir
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	appCgroup := "system.slice/rktlet-abc.service/system.slice/foo.service"
+	cgroupDir := filepath.Join(tmpDir, "memory", appCgroup)
+	writeFile(t, filepath.Join(cgroupDir, "memory.oom_control"), "oom_kill_disable 0\nunder_oom 0\noom_kill 0\n")
+	writeFile(t, filepath.Join(cgroupDir, "cgroup.event_control"), "")
+
+	ooms := make(chan string, 10)
+	w, err := newOOMWatcher(func(uuid, appName string) { ooms <- buildContainerID(uuid, appName) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go w.run()
+
+	assert.NoError(t, w.watch("1234", "foo", appCgroup))
+	// Watching twice is a no-op.
+	assert.NoError(t, w.watch("1234", "foo", appCgroup))
+	assert.Len(t, w.watches, 1)
+	var eventFd int
+	for fd := range w.watches {
+		eventFd = fd
+	}
+
+	// notify does what the kernel does on OOM events and cgroup removals.
+	notify := func() {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, 1)
+		if _, err := unix.Write(eventFd, buf); err != nil {
+			t.Fatalf("unable to write to eventfd: %v", err)
+		}
+	}
+
+	// Notifications without any OOM kill are ignored.
+	notify()
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, ooms)
+	writeFile(t, filepath.Join(cgroupDir, "memory.oom_control"), "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n")
+	notify()
+	select {
+	case id := <-ooms:
+		assert.Equal(t, "1234:foo", id)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no OOM event")
+	}
+
+	// The watch ends with the cgroup.
+	os.RemoveAll(cgroupDir)
+	notify()
+	for i := 0; i < 100; i++ {
+		w.lock.Lock()
+		watched := len(w.containers)
+		w.lock.Unlock()
+		if watched == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Empty(t, w.containers)
+	assert.Empty(t, ooms)
+}
+
+func TestWatchRunningAppsOOM(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_oom_watcher")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	kubernetesAnnotations := map[string]string{
+		kubernetesReservedAnnoPodName:      "foo",
+		kubernetesReservedAnnoPodUid:       "0",
+		kubernetesReservedAnnoPodAttempt:   "0",
+		kubernetesReservedAnnoPodNamespace: "default",
+	}
+	pods := []rktlib.Pod{{
+		UUID: "1",
+		Apps: []*rktlib.App{
+			{Name: "0-foo", State: rktlib.AppStateRunning},
+			{Name: "1-bar", State: rktlib.AppStateExited},
+			{Name: internalAppPrefix + "baz", State: rktlib.AppStateRunning},
+		},
+		UserAnnotations: kubernetesAnnotations,
+		State:           "running",
+	}, {
+		UUID:            "2",
+		Apps:            []*rktlib.App{{Name: "0-foo", State: rktlib.AppStateRunning}},
+		UserAnnotations: kubernetesAnnotations,
+		State:           "exited",
+	}, {
+		// Not a kubernetes pod.
+		UUID:  "3",
+		Apps:  []*rktlib.App{{Name: "0-foo", State: rktlib.AppStateRunning}},
+		State: "running",
+	}}
+	podsJson, err := json.Marshal(pods)
+	if err != nil {
+		t.Fatalf("could not marshal pods: %v", err)
+	}
+
+	mockCli := new(mocks.CLI)
+	mockCli.On("RunCommandContext", mock.Anything, "list", []string{"--format=json"}).Return([]string{string(podsJson)}, nil)
+	r := &RktRuntime{
+		CLI:     mockCli,
+		reader:  cli.NewCLIReader(mockCli),
+		dataDir: filepath.Join(tmpDir, "data"),
+	}
+	r.podCache = newPodCache(r, time.Minute)
+	r.oomWatcher, err = newOOMWatcher(r.recordAppOOM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every app has a cgroup which could be watched.
+	for _, p := range pods {
+		subcgroup := "rktlet-" + p.UUID + ".service"
+		writeFile(t, filepath.Join(r.podDir(p.UUID), "subcgroup"), subcgroup+"\n")
+		for _, app := range p.Apps {
+			cgroupDir := filepath.Join(util.CgroupRoot, "memory", subcgroup, "system.slice", app.Name+".service")
+			writeFile(t, filepath.Join(cgroupDir, "memory.oom_control"), "oom_kill_disable 0\nunder_oom 0\noom_kill 0\n")
+			writeFile(t, filepath.Join(cgroupDir, "cgroup.event_control"), "")
+		}
+	}
+
+	r.watchRunningAppsOOM(context.TODO())
+	assert.Equal(t, map[string]bool{"1:0-foo": true}, r.oomWatcher.containers)
+}
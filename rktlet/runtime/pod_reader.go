@@ -0,0 +1,282 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	appcschema "github.com/appc/spec/schema"
+	appctypes "github.com/appc/spec/schema/types"
+	"github.com/golang/glog"
+	rkt "github.com/rkt/rkt/api/v1"
+	"github.com/rkt/rkt/networking/netinfo"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+// The files of a pod's directory read to get its status, as laid out by rkt
+// and the coreos stage1.
+const (
+	podManifestFile = "pod"
+	podCreatedFile  = "pod-created"
+	podPidFile      = "pid"
+	podPpidFile     = "ppid"
+	// appStatusDir holds, for each app, an "<app>-created" and an
+	// "<app>-started" file, and an "<app>" file with its exit code once it
+	// exited.
+	appStatusDir = "stage1/rootfs/rkt/status"
+)
+
+// The states of a pod in the run directory, as reported by `rkt status`.
+const (
+	podStateRunning = "running"
+	podStateExited  = "exited"
+)
+
+// podFormatError is returned when the directory of a pod isn't in a format
+// rktlet knows of, e.g. because the pod isn't running anymore or was run by
+// an unknown stage1. The status of the pod must then be asked to rkt.
+type podFormatError struct {
+	uuid   string
+	reason string
+}
+
+func (e *podFormatError) Error() string {
+	return fmt.Sprintf("unrecognized on-disk state of pod %q: %s", e.uuid, e.reason)
+}
+
+func isPodFormatError(err error) bool {
+	_, ok := err.(*podFormatError)
+	return ok
+}
+
+// podStatus returns the status of a pod and its apps, read from the pod's
+// directory if possible, and from `rkt status` otherwise.
+func (r *RktRuntime) podStatus(ctx context.Context, uuid string) (*rkt.Pod, error) {
+	pod, err := r.readPod(uuid, "")
+	if err == nil {
+		return pod, nil
+	}
+	if !isPodFormatError(err) {
+		return nil, err
+	}
+	glog.V(4).Infof("rkt: falling back to rkt status: %v", err)
+
+	return r.reader.InspectPod(ctx, uuid)
+}
+
+// appStatus returns the status of an app, read from its pod's directory if
+// possible, and from `rkt app status` otherwise.
+func (r *RktRuntime) appStatus(ctx context.Context, uuid, appName string) (*rkt.App, error) {
+	pod, err := r.readPod(uuid, appName)
+	if err == nil {
+		if len(pod.Apps) == 0 {
+			return nil, fmt.Errorf("app %q not found in pod %q", appName, uuid)
+		}
+		return pod.Apps[0], nil
+	}
+	if !isPodFormatError(err) {
+		return nil, err
+	}
+	glog.V(4).Infof("rkt: falling back to rkt app status: %v", err)
+
+	return r.reader.InspectApp(ctx, uuid, appName)
+}
+
+// readPod reads the status of a running, or exited but not yet garbage
+// collected, pod from its directory, the same way `rkt status` does. If
+// appName isn't empty, only this app is read.
+func (r *RktRuntime) readPod(uuid, appName string) (*rkt.Pod, error) {
+	dir := r.podDir(uuid)
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, &podFormatError{uuid, "not in the run directory"}
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The stage1 of a running pod holds an exclusive lock on its directory.
+	state := podStateExited
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_SH|unix.LOCK_NB); err == unix.EWOULDBLOCK {
+		state = podStateRunning
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check the lock of pod %q: %v", uuid, err)
+	} else {
+		unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, podManifestFile))
+	if os.IsNotExist(err) {
+		return nil, &podFormatError{uuid, "no pod manifest"}
+	} else if err != nil {
+		return nil, err
+	}
+	var manifest appcschema.PodManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, &podFormatError{uuid, fmt.Sprintf("invalid pod manifest: %v", err)}
+	}
+
+	pod := &rkt.Pod{
+		UUID:  uuid,
+		State: state,
+	}
+
+	// The networks are only written once they are set up.
+	nets, err := netinfo.LoadAt(int(f.Fd()))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, &podFormatError{uuid, fmt.Sprintf("invalid network info: %v", err)}
+	}
+	pod.Networks = nets
+
+	// rkt before v1.20 doesn't write the creation file.
+	if createdAt, ok, err := fileModTime(dir, podCreatedFile, podManifestFile); err != nil {
+		return nil, err
+	} else if ok {
+		pod.CreatedAt = &createdAt
+	}
+	// Depending on the stage1, either the pid or the ppid file is written.
+	if startedAt, ok, err := fileModTime(dir, podPidFile, podPpidFile); err != nil {
+		return nil, err
+	} else if ok {
+		pod.StartedAt = &startedAt
+	}
+
+	if len(manifest.UserAnnotations) > 0 {
+		pod.UserAnnotations = manifest.UserAnnotations
+	}
+	if len(manifest.UserLabels) > 0 {
+		pod.UserLabels = manifest.UserLabels
+	}
+
+	for i := range manifest.Apps {
+		ra := &manifest.Apps[i]
+		pod.AppNames = append(pod.AppNames, ra.Name.String())
+		if appName != "" && ra.Name.String() != appName {
+			continue
+		}
+		app, err := readApp(uuid, dir, ra, &manifest)
+		if err != nil {
+			return nil, err
+		}
+		if state == podStateExited && app.State != rkt.AppStateExited {
+			// The pod was killed before the app's exit code was written.
+			app.State = rkt.AppStateExited
+		}
+		pod.Apps = append(pod.Apps, app)
+	}
+
+	return pod, nil
+}
+
+// readApp reads the status of an app of a pod from the pod's directory.
+func readApp(uuid, dir string, ra *appcschema.RuntimeApp, manifest *appcschema.PodManifest) (*rkt.App, error) {
+	app := &rkt.App{
+		Name:    ra.Name.String(),
+		State:   rkt.AppStateUnknown,
+		ImageID: ra.Image.ID.String(),
+	}
+	if ra.App != nil {
+		app.UserAnnotations = ra.App.UserAnnotations
+		app.UserLabels = ra.App.UserLabels
+	}
+
+	volumes := make(map[appctypes.ACName]appctypes.Volume, len(manifest.Volumes))
+	for _, vol := range manifest.Volumes {
+		volumes[vol.Name] = vol
+	}
+	for _, mnt := range ra.Mounts {
+		vol := volumes[mnt.Volume]
+		if mnt.AppVolume != nil {
+			vol = *mnt.AppVolume
+		}
+		var readOnly bool
+		if vol.ReadOnly != nil {
+			readOnly = *vol.ReadOnly
+		}
+		app.Mounts = append(app.Mounts, &rkt.Mount{
+			Name:          mnt.Volume.String(),
+			ContainerPath: mnt.Path,
+			HostPath:      vol.Source,
+			ReadOnly:      readOnly,
+		})
+	}
+
+	statusDir := filepath.Join(dir, appStatusDir)
+	if _, err := os.Stat(filepath.Join(dir, "stage1", "rootfs")); os.IsNotExist(err) {
+		return nil, &podFormatError{uuid, "no stage1 rootfs"}
+	} else if err != nil {
+		return nil, err
+	}
+
+	createdAt, ok, err := fileModTime(statusDir, app.Name+"-created")
+	if err != nil || !ok {
+		return app, err
+	}
+	app.State = rkt.AppStateCreated
+	app.CreatedAt = &createdAt
+
+	startedAt, ok, err := fileModTime(statusDir, app.Name+"-started")
+	if err != nil || !ok {
+		return app, err
+	}
+	app.State = rkt.AppStateRunning
+	app.StartedAt = &startedAt
+
+	exitFile := filepath.Join(statusDir, app.Name)
+	data, err := ioutil.ReadFile(exitFile)
+	if os.IsNotExist(err) {
+		return app, nil
+	} else if err != nil {
+		return nil, err
+	}
+	exitCode, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil, &podFormatError{uuid, fmt.Sprintf("invalid exit code of app %q: %v", app.Name, err)}
+	}
+	finishedAt, _, err := fileModTime(statusDir, app.Name)
+	if err != nil {
+		return nil, err
+	}
+	exitCode32 := int32(exitCode)
+	app.State = rkt.AppStateExited
+	app.ExitCode = &exitCode32
+	app.FinishedAt = &finishedAt
+
+	return app, nil
+}
+
+// fileModTime returns the modification time, in nanoseconds since the epoch,
+// of the first of the given files of a directory that exists.
+func fileModTime(dir string, names ...string) (int64, bool, error) {
+	for _, name := range names {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, false, err
+		}
+		return fi.ModTime().UnixNano(), true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appcschema "github.com/appc/spec/schema"
+	actypes "github.com/appc/spec/schema/types"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	rktlib "github.com/rkt/rkt/api/v1"
+	"github.com/rkt/rkt/networking/netinfo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestReadPod(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_pod_reader")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mockCli := new(mocks.CLI)
+	r := &RktRuntime{CLI: mockCli, reader: cli.NewCLIReader(mockCli), dataDir: filepath.Join(tmpDir, "data")}
+	podDir := r.podDir("1234")
+
+	manifest := appcschema.BlankPodManifest()
+	manifest.UserAnnotations = actypes.UserAnnotations{
+		kubernetesReservedAnnoPodName:      "foo",
+		kubernetesReservedAnnoPodUid:       "0",
+		kubernetesReservedAnnoPodAttempt:   "0",
+		kubernetesReservedAnnoPodNamespace: "default",
+	}
+	manifest.Volumes = []actypes.Volume{{Name: *actypes.MustACName("data"), Kind: "host", Source: "/srv/data"}}
+	readOnly := true
+	manifest.Apps = appcschema.AppList{{
+		Name:   *actypes.MustACName("0-foo"),
+		Image:  appcschema.RuntimeImage{ID: *actypes.NewHashSHA512([]byte("foo"))},
+		App:    &actypes.App{Exec: []string{"/foo"}, User: "0", Group: "0", UserLabels: map[string]string{"app": "foo"}},
+		Mounts: []appcschema.Mount{{Volume: *actypes.MustACName("data"), Path: "/data"}},
+	}, {
+		Name:  *actypes.MustACName("1-bar"),
+		Image: appcschema.RuntimeImage{ID: *actypes.NewHashSHA512([]byte("bar"))},
+		Mounts: []appcschema.Mount{{
+			Volume:    *actypes.MustACName("config"),
+			Path:      "/config",
+			AppVolume: &actypes.Volume{Name: *actypes.MustACName("config"), Kind: "host", Source: "/etc/bar", ReadOnly: &readOnly},
+		}},
+	}, {
+		Name:  *actypes.MustACName("2-baz"),
+		Image: appcschema.RuntimeImage{ID: *actypes.NewHashSHA512([]byte("baz"))},
+	}}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("unable to marshal pod manifest: %v", err)
+	}
+
+	// Without a pod manifest, rkt is asked.
+	mkdir(t, podDir)
+	statusJson, _ := json.Marshal(rktlib.Pod{UUID: "1234", State: "running", UserAnnotations: manifest.UserAnnotations})
+	mockCli.On("RunCommandContext", mock.Anything, "status", []string{"1234", "--format=json"}).Return([]string{string(statusJson)}, nil)
+	_, err = r.PodSandboxStatus(context.TODO(), &runtimeApi.PodSandboxStatusRequest{PodSandboxId: "1234"})
+	assert.NoError(t, err)
+	mockCli.AssertNumberOfCalls(t, "RunCommandContext", 1)
+
+	writeFile(t, filepath.Join(podDir, "pod"), string(data))
+	writeFile(t, filepath.Join(podDir, "pod-created"), "")
+	writeFile(t, filepath.Join(podDir, "pid"), "42")
+	if err := netinfo.Save(podDir, []netinfo.NetInfo{{NetName: kubernetesNetworkName, IP: net.ParseIP("10.1.2.3")}}); err != nil {
+		t.Fatalf("unable to save netinfo: %v", err)
+	}
+	statusDir := filepath.Join(podDir, appStatusDir)
+	writeFile(t, filepath.Join(statusDir, "0-foo-created"), "")
+	writeFile(t, filepath.Join(statusDir, "0-foo-started"), "")
+	writeFile(t, filepath.Join(statusDir, "1-bar-created"), "")
+	writeFile(t, filepath.Join(statusDir, "1-bar-started"), "")
+	writeFile(t, filepath.Join(statusDir, "1-bar"), "3\n")
+
+	// The stage1 of a running pod locks its directory.
+	lock, err := os.Open(podDir)
+	if err != nil {
+		t.Fatalf("unable to open pod directory: %v", err)
+	}
+	defer lock.Close()
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatalf("unable to lock pod directory: %v", err)
+	}
+
+	pod, err := r.readPod("1234", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "running", pod.State)
+	assert.NotNil(t, pod.CreatedAt)
+	assert.NotNil(t, pod.StartedAt)
+	assert.Equal(t, []string{"0-foo", "1-bar", "2-baz"}, pod.AppNames)
+	assert.Equal(t, "10.1.2.3", getIP(pod.Networks))
+	assert.Len(t, pod.Apps, 3)
+
+	foo := pod.Apps[0]
+	assert.Equal(t, rktlib.AppStateRunning, foo.State)
+	assert.NotNil(t, foo.StartedAt)
+	assert.Nil(t, foo.ExitCode)
+	assert.Equal(t, map[string]string{"app": "foo"}, foo.UserLabels)
+	assert.Equal(t, []*rktlib.Mount{{Name: "data", ContainerPath: "/data", HostPath: "/srv/data"}}, foo.Mounts)
+
+	bar := pod.Apps[1]
+	assert.Equal(t, rktlib.AppStateExited, bar.State)
+	if assert.NotNil(t, bar.ExitCode) {
+		assert.Equal(t, int32(3), *bar.ExitCode)
+	}
+	assert.NotNil(t, bar.FinishedAt)
+	assert.Equal(t, []*rktlib.Mount{{Name: "config", ContainerPath: "/config", HostPath: "/etc/bar", ReadOnly: true}}, bar.Mounts)
+
+	assert.Equal(t, rktlib.AppStateUnknown, pod.Apps[2].State)
+
+	resp, err := r.PodSandboxStatus(context.TODO(), &runtimeApi.PodSandboxStatusRequest{PodSandboxId: "1234"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, runtimeApi.PodSandboxState_SANDBOX_READY, resp.Status.State)
+	assert.Equal(t, "10.1.2.3", resp.Status.Network.Ip)
+	mockCli.AssertNumberOfCalls(t, "RunCommandContext", 1)
+
+	app, err := r.appStatus(context.TODO(), "1234", "1-bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, bar, app)
+
+	// Once the stage1 is gone, the apps which didn't exit were killed.
+	unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+	pod, err = r.readPod("1234", "0-foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "exited", pod.State)
+	if assert.Len(t, pod.Apps, 1) {
+		assert.Equal(t, rktlib.AppStateExited, pod.Apps[0].State)
+	}
+}
@@ -17,20 +17,35 @@ limitations under the License.
 package runtime
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
-	rkt "github.com/rkt/rkt/api/v1"
 	"golang.org/x/net/context"
 	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
+// DefaultPodReadyTimeout is how long to wait for a new pod to be ready,
+// unless configured otherwise.
+const DefaultPodReadyTimeout = 10 * time.Second
+
+const (
+	// podUUIDPollInterval is how often the UUID file of a new pod is checked
+	// when no pod event wakes up the wait.
+	podUUIDPollInterval = time.Second
+
+	// sandboxProcessFile records, in the directory of a pod, the id of the
+	// process running it, i.e. the name of its transient unit with systemd.
+	sandboxProcessFile = "rktlet-process"
+)
+
 func formatPod(metaData *runtimeApi.PodSandboxMetadata) string {
 	return fmt.Sprintf("%s_%s(%s)", metaData.Name, metaData.Namespace, metaData.Uid)
 }
@@ -58,7 +73,11 @@ func (r *RktRuntime) RunPodSandbox(ctx context.Context, req *runtimeApi.RunPodSa
 		cgroupParent = linux.CgroupParent
 	}
 
+	// The pod has podReadyTimeout to be ready, including the time the init
+	// process waited for it to start.
+	deadline := time.Now().Add(r.podReadyTimeout)
 	id, err := r.Init.StartProcess(cgroupParent, cmd[0], cmd[1:]...)
+	defer r.invalidatePods()
 	if err != nil {
 		glog.Errorf("failed to run pod %q: %v", formatPod(metaData), err)
 		return nil, err
@@ -67,27 +86,48 @@ func (r *RktRuntime) RunPodSandbox(ctx context.Context, req *runtimeApi.RunPodSa
 
 	glog.V(4).Infof("pod sandbox is running as service %q", id)
 
-	var rktUUID string
-	// TODO, switch to sdnotify, possibly with a fallback for non-systemd or non-coreos stage1
-	for i := 0; i < 100; i++ {
-		data, err := ioutil.ReadAll(podUUIDFile)
-		if err != nil {
-			return nil, fmt.Errorf("error reading rkt pod UUID file: %v", err)
-		}
-		if len(data) != 0 {
-			rktUUID = string(data)
-			break
-		}
+	// With systemd, the stage1 notified it's ready by the time StartProcess
+	// returns, and the UUID file was written before. Otherwise, wait for rkt
+	// to create the pod and for the pod to be ready.
+	var ready bool
+	if status, err := r.Init.ProcessStatus(id); err != nil {
+		glog.Warningf("rkt: unable to get the status of %q: %v", id, err)
+	} else {
+		ready = status.Ready
+	}
 
-		time.Sleep(100 * time.Millisecond)
+	rktUUID, err := r.waitPodUUID(ctx, podUUIDFile, time.Until(deadline))
+	if err != nil {
+		return nil, err
 	}
 	if rktUUID == "" {
-		return nil, fmt.Errorf("waited 10s for pod sandbox to start, but it didn't: %v", k8sPodUid)
+		failure := r.processFailure(id)
+		if err := r.Init.StopProcess(context.Background(), id); err != nil {
+			glog.Warningf("rkt: unable to stop %q: %v", id, err)
+		} else if err := r.Init.RemoveProcess(id); err != nil {
+			glog.Warningf("rkt: unable to remove %q: %v", id, err)
+		}
+		return nil, fmt.Errorf("waited %v for pod sandbox to start, but it didn't: %v%s", r.podReadyTimeout, k8sPodUid, failure)
+	}
+
+	if !ready {
+		// The status is read from the pod's directory, so let rkt wait for
+		// the pod to be ready first.
+		timeout := time.Until(deadline)
+		if timeout < time.Second {
+			timeout = time.Second
+		}
+		if _, err := r.RunCommandContext(ctx, "status", rktUUID, "--wait-ready="+timeout.String()); err != nil {
+			glog.Warningf("sandbox got a UUID but did not have a ready status after %v: %v%s", r.podReadyTimeout, err, r.processFailure(id))
+		}
+	}
+	if err := r.setSandboxProcess(rktUUID, id); err != nil {
+		glog.Warningf("rkt: unable to record the process of pod %q: %v", rktUUID, err)
 	}
 
 	statusResp, err := r.PodSandboxStatus(ctx, &runtimeApi.PodSandboxStatusRequest{PodSandboxId: rktUUID})
 	if err != nil {
-		return &runtimeApi.RunPodSandboxResponse{PodSandboxId: rktUUID}, fmt.Errorf("unable to get status: %v", err)
+		return &runtimeApi.RunPodSandboxResponse{PodSandboxId: rktUUID}, cli.WrapError(err, "unable to get status")
 	}
 
 	if statusResp.Status.State != runtimeApi.PodSandboxState_SANDBOX_READY {
@@ -97,8 +137,50 @@ func (r *RktRuntime) RunPodSandbox(ctx context.Context, req *runtimeApi.RunPodSa
 	return &runtimeApi.RunPodSandboxResponse{PodSandboxId: rktUUID}, err
 }
 
+// waitPodUUID waits for rkt to write the UUID of a new pod to the given file,
+// and returns it. It returns an empty UUID if it wasn't written within the
+// timeout. rkt writes the file once the pod is created in its data directory,
+// so the file is checked again on every pod event.
+func (r *RktRuntime) waitPodUUID(ctx context.Context, uuidFile *os.File, timeout time.Duration) (string, error) {
+	var events <-chan podEvent
+	if r.podWatcher != nil {
+		var unsubscribe func()
+		events, unsubscribe = r.podWatcher.subscribe()
+		defer unsubscribe()
+	}
+
+	deadline := time.After(timeout)
+	// Poll anyway, in case an event was missed or the pods aren't watched.
+	ticker := time.NewTicker(podUUIDPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := uuidFile.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("error reading rkt pod UUID file: %v", err)
+		}
+		data, err := ioutil.ReadAll(uuidFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading rkt pod UUID file: %v", err)
+		}
+		if len(data) != 0 {
+			return string(data), nil
+		}
+
+		select {
+		case <-events:
+		case <-ticker.C:
+		case <-deadline:
+			return "", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
 func (r *RktRuntime) stopPodSandbox(ctx context.Context, id string, force bool) error {
-	output, err := r.RunCommand(
+	defer r.invalidatePods()
+
+	output, err := r.RunCommandContext(ctx,
 		"stop",
 		"--force="+strconv.FormatBool(force),
 		id,
@@ -112,6 +194,12 @@ func (r *RktRuntime) stopPodSandbox(ctx context.Context, id string, force bool)
 		glog.V(4).Infof("ignoring stop error for idempotency,\noutput: %s\nerr: %v", output, err)
 	}
 
+	if process := r.sandboxProcess(id); process != "" {
+		if err := r.Init.StopProcess(ctx, process); err != nil {
+			return err
+		}
+	}
+
 	if _, err := r.PodSandboxStatus(ctx, &runtimeApi.PodSandboxStatusRequest{PodSandboxId: id}); err != nil {
 		return err
 	}
@@ -119,44 +207,89 @@ func (r *RktRuntime) stopPodSandbox(ctx context.Context, id string, force bool)
 	return nil
 }
 
+// processFailure describes why the process running a pod exited, if it
+// did, with its last output.
+func (r *RktRuntime) processFailure(id string) string {
+	status, err := r.Init.ProcessStatus(id)
+	if err != nil || status.Running {
+		return ""
+	}
+	failure := fmt.Sprintf("\nprocess %s exited with code %d (%s)", id, status.ExitCode, status.Reason)
+	if logs := r.Init.ProcessLogs(id); logs != "" {
+		failure += fmt.Sprintf("\nlast output of process %s:\n%s", id, logs)
+	}
+	return failure
+}
+
+func (r *RktRuntime) setSandboxProcess(uuid, id string) error {
+	return ioutil.WriteFile(filepath.Join(r.podDir(uuid), sandboxProcessFile), []byte(id), 0644)
+}
+
+// sandboxProcess returns the id of the process running a pod, as recorded
+// by RunPodSandbox. For the pods run before it was recorded, the name of the
+// transient unit is found in the cgroup of the stage1 instead. It returns an
+// empty id if it's unknown.
+func (r *RktRuntime) sandboxProcess(uuid string) string {
+	if id, err := ioutil.ReadFile(filepath.Join(r.podDir(uuid), sandboxProcessFile)); err == nil {
+		return strings.TrimSpace(string(id))
+	}
+	subcgroup, err := ioutil.ReadFile(filepath.Join(r.podDir(uuid), "subcgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, name := range strings.Split(strings.TrimSpace(string(subcgroup)), "/") {
+		if strings.HasPrefix(name, "rktlet-") && strings.HasSuffix(name, ".service") {
+			return strings.TrimSuffix(name, ".service")
+		}
+	}
+	return ""
+}
+
 func (r *RktRuntime) StopPodSandbox(ctx context.Context, req *runtimeApi.StopPodSandboxRequest) (*runtimeApi.StopPodSandboxResponse, error) {
-	err := r.stopPodSandbox(ctx, req.PodSandboxId, false)
+	unlock, err := r.lockSandbox(ctx, req.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = r.stopPodSandbox(ctx, req.PodSandboxId, false)
 	return &runtimeApi.StopPodSandboxResponse{}, err
 }
 
 func (r *RktRuntime) RemovePodSandbox(ctx context.Context, req *runtimeApi.RemovePodSandboxRequest) (*runtimeApi.RemovePodSandboxResponse, error) {
+	unlock, err := r.lockSandbox(ctx, req.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	// Force stop first, per api contract "if there are any running containers in
 	// the sandbox, they must be forcibly terminated
 	r.stopPodSandbox(ctx, req.PodSandboxId, true)
 
-	output, err := r.RunCommand("rm", req.PodSandboxId)
+	// The process is found from the pod's directory, which goes with it.
+	process := r.sandboxProcess(req.PodSandboxId)
+	output, err := r.RunCommandContext(ctx, "rm", req.PodSandboxId)
+	r.invalidatePods()
+	if err != nil && !cli.IsErrorKind(err, cli.ErrNotFound) {
+		return nil, cli.WrapError(err, "failed to remove pod %q, output: %s\n", req.PodSandboxId, output)
+	}
+	if process != "" {
+		if err := r.Init.RemoveProcess(process); err != nil {
+			glog.Warningf("rkt: unable to remove process %q of pod %q: %v", process, req.PodSandboxId, err)
+		}
+	}
 
-	return &runtimeApi.RemovePodSandboxResponse{}, fmt.Errorf("output: %s\nerr: %v\n", output, err)
+	return &runtimeApi.RemovePodSandboxResponse{}, nil
 }
 
 func (r *RktRuntime) PodSandboxStatus(ctx context.Context, req *runtimeApi.PodSandboxStatusRequest) (*runtimeApi.PodSandboxStatusResponse, error) {
-	resp, err := r.RunCommand("status", req.PodSandboxId, "--format=json", "--wait-ready=10s")
+	pod, err := r.podStatus(ctx, req.PodSandboxId)
 	if err != nil {
-		glog.Warningf("sandbox got a UUID but did not have a ready status after 10s: %v", err)
-
-		// the pod wasn't ready after 10s, try to get its status so we can
-		// return meaningful data to the kubelet
-		resp, err = r.RunCommand("status", req.PodSandboxId, "--format=json")
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	if len(resp) != 1 {
-		return nil, fmt.Errorf("unexpected result %q", resp)
-	}
-
-	var pod rkt.Pod
-	if err := json.Unmarshal([]byte(resp[0]), &pod); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal pod: %v", err)
+		return nil, err
 	}
 
-	status, err := toPodSandboxStatus(&pod)
+	status, err := toPodSandboxStatus(pod)
 	if err != nil {
 		return nil, fmt.Errorf("error converting pod status: %v", err)
 	}
@@ -164,20 +297,11 @@ func (r *RktRuntime) PodSandboxStatus(ctx context.Context, req *runtimeApi.PodSa
 }
 
 func (r *RktRuntime) ListPodSandbox(ctx context.Context, req *runtimeApi.ListPodSandboxRequest) (*runtimeApi.ListPodSandboxResponse, error) {
-	resp, err := r.RunCommand("list", "--format=json")
+	pods, err := r.listPods(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp) != 1 {
-		return nil, fmt.Errorf("unexpected result %q", resp)
-	}
-
-	var pods []rkt.Pod
-	if err := json.Unmarshal([]byte(resp[0]), &pods); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal pods: %v", err)
-	}
-
 	sandboxes := make([]*runtimeApi.PodSandbox, 0, len(pods))
 	for i, _ := range pods {
 		p := pods[i]
@@ -18,12 +18,18 @@ package runtime
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
 	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
 	rktlib "github.com/rkt/rkt/api/v1"
 	"github.com/rkt/rkt/networking/netinfo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
@@ -322,14 +328,16 @@ func TestListPodSandbox(t *testing.T) {
 	for i, testCase := range testCases {
 		mockCli := new(mocks.CLI)
 		mockRuntime := &RktRuntime{
-			CLI: mockCli,
+			CLI:    mockCli,
+			reader: cli.NewCLIReader(mockCli),
 		}
+		mockRuntime.podCache = newPodCache(mockRuntime, time.Minute)
 
 		rktpodJson, err := json.Marshal(testCase.RktPods)
 		if err != nil {
 			t.Fatalf("%d: could not marshal input: %v", i, err)
 		}
-		mockCli.On("RunCommand", "list", []string{"--format=json"}).Return([]string{string(rktpodJson)}, nil)
+		mockCli.On("RunCommandContext", mock.Anything, "list", []string{"--format=json"}).Return([]string{string(rktpodJson)}, nil)
 
 		resp, err := mockRuntime.ListPodSandbox(context.TODO(), &runtime.ListPodSandboxRequest{
 			Filter: testCase.Filter,
@@ -343,3 +351,51 @@ func TestListPodSandbox(t *testing.T) {
 		mockCli.AssertExpectations(t)
 	}
 }
+
+func TestStopPodSandboxStopsProcess(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_pod_sandbox")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mockCli := new(mocks.CLI)
+	mockInit := new(mocks.Init)
+	r := &RktRuntime{CLI: mockCli, Init: mockInit, reader: cli.NewCLIReader(mockCli), dataDir: filepath.Join(tmpDir, "data")}
+	r.podCache = newPodCache(r, time.Minute)
+
+	for _, uuid := range []string{"1234", "5678"} {
+		statusJson, _ := json.Marshal(rktlib.Pod{UUID: uuid, State: "exited", UserAnnotations: map[string]string{
+			kubernetesReservedAnnoPodName:      "foo",
+			kubernetesReservedAnnoPodUid:       "0",
+			kubernetesReservedAnnoPodAttempt:   "0",
+			kubernetesReservedAnnoPodNamespace: "default",
+		}})
+		mockCli.On("RunCommandContext", mock.Anything, "status", []string{uuid, "--format=json"}).Return([]string{string(statusJson)}, nil)
+		mockCli.On("RunCommandContext", mock.Anything, "stop", []string{"--force=false", uuid}).Return(nil, nil)
+	}
+	mockInit.On("StopProcess", mock.Anything, "rktlet-abc").Return(nil)
+	mockInit.On("StopProcess", mock.Anything, "rktlet-def").Return(nil)
+
+	// The unit recorded by RunPodSandbox is stopped.
+	mkdir(t, r.podDir("1234"))
+	if err := r.setSandboxProcess("1234", "rktlet-abc"); err != nil {
+		t.Fatalf("unable to record process: %v", err)
+	}
+	_, err = r.StopPodSandbox(context.TODO(), &runtime.StopPodSandboxRequest{PodSandboxId: "1234"})
+	assert.NoError(t, err)
+
+	// Without a record, the unit is found from the cgroup of the stage1.
+	writeFile(t, filepath.Join(r.podDir("5678"), "subcgroup"), "kubepods.slice/rktlet-def.service\n")
+	_, err = r.StopPodSandbox(context.TODO(), &runtime.StopPodSandboxRequest{PodSandboxId: "5678"})
+	assert.NoError(t, err)
+
+	// The stopped process is removed with the pod.
+	mockCli.On("RunCommandContext", mock.Anything, "stop", []string{"--force=true", "1234"}).Return(nil, nil)
+	mockCli.On("RunCommandContext", mock.Anything, "rm", []string{"1234"}).Return(nil, nil)
+	mockInit.On("RemoveProcess", "rktlet-abc").Return(nil)
+	_, err = r.RemovePodSandbox(context.TODO(), &runtime.RemovePodSandboxRequest{PodSandboxId: "1234"})
+	assert.NoError(t, err)
+
+	mockInit.AssertExpectations(t)
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+// The directories of rkt's data directory pods move through during their
+// lifecycle.
+const (
+	podStatePrepare       = "prepare"
+	podStateRun           = "run"
+	podStateExitedGarbage = "exited-garbage"
+	podStateGarbage       = "garbage"
+)
+
+var watchedPodStates = []string{podStatePrepare, podStateRun, podStateExitedGarbage, podStateGarbage}
+
+// podEvent is a change to a pod, or to one of its apps, seen in rkt's data
+// directory.
+type podEvent struct {
+	UUID string
+	// State is the directory the pod is in, e.g. "run".
+	State string
+	// App is set when an app was added to, or removed from, the pod.
+	App string
+	// Removed is set when the pod left State, or the app was removed.
+	Removed bool
+}
+
+// podWatcher turns changes in the pods directory of rkt into pod events. Each
+// running pod's directory is watched too, so apps being added or removed,
+// and the pod becoming ready, are noticed.
+type podWatcher struct {
+	podsDir string
+	watcher *fsnotify.Watcher
+	// onEvent is called for every event, before subscribers are woken up.
+	onEvent func(podEvent)
+
+	lock        sync.Mutex
+	subscribers map[chan podEvent]struct{}
+}
+
+// newPodWatcher starts watching the pods of the data directory. The
+// directories that don't exist yet are watched once rkt creates them.
+func newPodWatcher(dataDir string, onEvent func(podEvent)) (*podWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &podWatcher{
+		podsDir:     filepath.Join(dataDir, "pods"),
+		watcher:     watcher,
+		onEvent:     onEvent,
+		subscribers: make(map[chan podEvent]struct{}),
+	}
+	w.addWatch(dataDir)
+	w.addWatch(w.podsDir)
+	for _, state := range watchedPodStates {
+		w.addWatch(filepath.Join(w.podsDir, state))
+	}
+	runDir := filepath.Join(w.podsDir, podStateRun)
+	if entries, err := readDirNames(runDir); err == nil {
+		for _, uuid := range entries {
+			w.addWatch(filepath.Join(runDir, uuid))
+			w.addWatch(filepath.Join(runDir, uuid, "appsinfo"))
+		}
+	}
+
+	return w, nil
+}
+
+// subscribe returns a channel receiving the events from now on, and a
+// function to call once done with it. Events are dropped if the subscriber
+// doesn't keep up, so subscribers should check the actual state when woken
+// up rather than rely on every event.
+func (w *podWatcher) subscribe() (<-chan podEvent, func()) {
+	ch := make(chan podEvent, 16)
+
+	w.lock.Lock()
+	w.subscribers[ch] = struct{}{}
+	w.lock.Unlock()
+
+	return ch, func() {
+		w.lock.Lock()
+		delete(w.subscribers, ch)
+		w.lock.Unlock()
+	}
+}
+
+// run processes the changes in the pods directory. It returns when the
+// watcher is closed.
+func (w *podWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been lost, let the caches know.
+			glog.Warningf("rkt: error watching pods: %v", err)
+			w.publish(podEvent{})
+		}
+	}
+}
+
+func (w *podWatcher) close() error {
+	return w.watcher.Close()
+}
+
+func (w *podWatcher) handle(event fsnotify.Event) {
+	created := event.Op&fsnotify.Create != 0
+	removed := event.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+
+	if event.Name == w.podsDir {
+		// The pods directory was created. rkt may have created the state
+		// directories before it could be watched.
+		if created {
+			w.addWatch(w.podsDir)
+			for _, state := range watchedPodStates {
+				w.addWatch(filepath.Join(w.podsDir, state))
+			}
+		}
+		return
+	}
+
+	rel, err := filepath.Rel(w.podsDir, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// Something else in the data directory.
+		return
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	switch {
+	case len(parts) == 1:
+		// A state directory was created.
+		if created {
+			w.addWatch(event.Name)
+		}
+	case len(parts) == 2:
+		// A pod entered or left a state.
+		if parts[0] == podStateRun {
+			if created {
+				w.addWatch(event.Name)
+				w.addWatch(filepath.Join(event.Name, "appsinfo"))
+			} else if removed {
+				// inotify watches follow the directories when they're
+				// renamed, so the pod would still be watched in its next
+				// state, under its old name.
+				w.removeWatches(event.Name, filepath.Join(event.Name, "appsinfo"))
+			}
+		}
+		w.publish(podEvent{UUID: parts[1], State: parts[0], Removed: removed})
+	case len(parts) == 3:
+		// A file of a running pod changed, e.g. it's now ready.
+		if created && parts[2] == "appsinfo" {
+			w.addWatch(event.Name)
+		}
+		w.publish(podEvent{UUID: parts[1], State: parts[0]})
+	case len(parts) == 4 && parts[2] == "appsinfo":
+		w.publish(podEvent{UUID: parts[1], State: parts[0], App: parts[3], Removed: removed})
+	}
+}
+
+func (w *podWatcher) publish(event podEvent) {
+	glog.V(6).Infof("rkt: pod event %+v", event)
+	if w.onEvent != nil {
+		w.onEvent(event)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// addWatch watches a directory if it exists.
+func (w *podWatcher) addWatch(dir string) {
+	if err := w.watcher.Add(dir); err != nil && !os.IsNotExist(err) {
+		glog.Warningf("rkt: unable to watch %q: %v", dir, err)
+	}
+}
+
+// removeWatches stops watching directories in the background: removing a
+// watch waits for the pending events to be read, so it can't be done while
+// handling one.
+func (w *podWatcher) removeWatches(dirs ...string) {
+	go func() {
+		for _, dir := range dirs {
+			// The watch is gone already if the directory was removed, or
+			// both the move and the move of the directory itself were seen.
+			if err := w.watcher.Remove(dir); err != nil {
+				glog.V(6).Infof("rkt: not watching %q anymore: %v", dir, err)
+			}
+		}
+	}()
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// expectPodEvent waits for an event, ignoring the other ones.
+func expectPodEvent(t *testing.T, events <-chan podEvent, expected podEvent) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("didn't get event %+v", expected)
+		}
+	}
+}
+
+func mkdir(t *testing.T, path string) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("unable to create %q: %v", path, err)
+	}
+}
+
+func TestPodWatcher(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_watcher")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var invalidations int32
+	w, err := newPodWatcher(tmpDir, func(podEvent) { atomic.AddInt32(&invalidations, 1) })
+	if err != nil {
+		t.Fatalf("unable to watch pods: %v", err)
+	}
+	defer w.close()
+	go w.run()
+
+	events, unsubscribe := w.subscribe()
+	defer unsubscribe()
+
+	// rkt creates its directories on first use.
+	podsDir := filepath.Join(tmpDir, "pods")
+	mkdir(t, podsDir)
+	for _, state := range watchedPodStates {
+		mkdir(t, filepath.Join(podsDir, state))
+	}
+	// Give the watcher a chance to watch the new directories.
+	time.Sleep(100 * time.Millisecond)
+
+	mkdir(t, filepath.Join(podsDir, "prepare", "1234"))
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "prepare"})
+
+	if err := os.Rename(filepath.Join(podsDir, "prepare", "1234"), filepath.Join(podsDir, "run", "1234")); err != nil {
+		t.Fatalf("unable to move pod: %v", err)
+	}
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "prepare", Removed: true})
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "run"})
+
+	mkdir(t, filepath.Join(podsDir, "run", "1234", "appsinfo"))
+	time.Sleep(100 * time.Millisecond)
+	mkdir(t, filepath.Join(podsDir, "run", "1234", "appsinfo", "0-foo"))
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "run", App: "0-foo"})
+
+	if err := os.Rename(filepath.Join(podsDir, "run", "1234"), filepath.Join(podsDir, "exited-garbage", "1234")); err != nil {
+		t.Fatalf("unable to move pod: %v", err)
+	}
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "run", Removed: true})
+	expectPodEvent(t, events, podEvent{UUID: "1234", State: "exited-garbage"})
+
+	// The pod isn't watched anymore once it left the run directory.
+	time.Sleep(100 * time.Millisecond)
+	if err := os.Remove(filepath.Join(podsDir, "exited-garbage", "1234", "appsinfo", "0-foo")); err != nil {
+		t.Fatalf("unable to remove app: %v", err)
+	}
+	mkdir(t, filepath.Join(podsDir, "prepare", "5678"))
+	for event := range events {
+		if event.App != "" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if event.UUID == "5678" {
+			break
+		}
+	}
+
+	if atomic.LoadInt32(&invalidations) == 0 {
+		t.Errorf("expected the events to invalidate the cache")
+	}
+}
+
+func TestWaitPodUUID(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_watcher")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	mkdir(t, filepath.Join(tmpDir, "pods", "prepare"))
+
+	w, err := newPodWatcher(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("unable to watch pods: %v", err)
+	}
+	defer w.close()
+	go w.run()
+	r := &RktRuntime{podWatcher: w}
+
+	uuidFile, err := ioutil.TempFile(tmpDir, "uuid")
+	if err != nil {
+		t.Fatalf("unable to create uuid file: %v", err)
+	}
+	defer uuidFile.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ioutil.WriteFile(uuidFile.Name(), []byte("1234"), 0644)
+		os.Mkdir(filepath.Join(tmpDir, "pods", "prepare", "1234"), 0755)
+	}()
+
+	// The pod event wakes the wait up long before the poll interval.
+	start := time.Now()
+	uuid, err := r.waitPodUUID(context.TODO(), uuidFile, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "1234" {
+		t.Errorf("expected uuid 1234, got %q", uuid)
+	}
+	if elapsed := time.Since(start); elapsed >= podUUIDPollInterval {
+		t.Errorf("waited %v for the uuid", elapsed)
+	}
+
+	// Nothing happens: the wait times out.
+	emptyFile, err := ioutil.TempFile(tmpDir, "uuid")
+	if err != nil {
+		t.Fatalf("unable to create uuid file: %v", err)
+	}
+	defer emptyFile.Close()
+	uuid, err = r.waitPodUUID(context.TODO(), emptyFile, 100*time.Millisecond)
+	if err != nil || uuid != "" {
+		t.Errorf("expected timeout, got %q, %v", uuid, err)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"golang.org/x/sys/unix"
+)
+
+// PortForward copies data between the stream and a port of the pod sandbox.
+// The connection to the port is made from within the network namespace of the
+// pod, so nothing (e.g. socat) is needed in the stage1 image.
+func (es *execShim) PortForward(sandboxID string, port int32, stream io.ReadWriteCloser) error {
+	defer stream.Close()
+
+	netnsPath, err := es.netnsPath(sandboxID)
+	if err != nil {
+		return cli.WrapError(err, "unable to find network namespace of pod %q", sandboxID)
+	}
+
+	// Services may only listen on one of the loopback addresses.
+	conn, err := dialInNetns(netnsPath, "tcp", fmt.Sprintf("127.0.0.1:%d", port), fmt.Sprintf("[::1]:%d", port))
+	if err != nil {
+		return fmt.Errorf("unable to connect to port %d of pod %q: %v", port, sandboxID, err)
+	}
+	defer conn.Close()
+	glog.V(4).Infof("port-forwarding to port %d of pod %q", port, sandboxID)
+
+	go func() {
+		if _, err := io.Copy(conn, stream); err != nil {
+			glog.V(4).Infof("error copying to port %d of pod %q: %v", port, sandboxID, err)
+		}
+		// Let the application know there's nothing more coming, it will
+		// close its side once it's done answering.
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+	}()
+
+	if _, err := io.Copy(stream, conn); err != nil {
+		return fmt.Errorf("error copying from port %d of pod %q: %v", port, sandboxID, err)
+	}
+	return nil
+}
+
+// netnsPath returns the path to the network namespace of a pod.
+// rkt records the path of the network namespace it creates in the 'netns'
+// file of the pod directory. Pods without their own network namespace (e.g.
+// with host networking) don't have it, in which case the network namespace of
+// the pod's init process is used.
+func (es *execShim) netnsPath(uuid string) (string, error) {
+	dir := podDir(es.dataDir, uuid)
+
+	netns, err := ioutil.ReadFile(filepath.Join(dir, "netns"))
+	if err == nil {
+		return strings.TrimSpace(string(netns)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	pid, err := ioutil.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(util.ProcRoot, strings.TrimSpace(string(pid)), "ns", "net"), nil
+}
+
+// dialInNetns connects to the first of the addresses accepting connections,
+// from within the given network namespace. The returned connection can be
+// used from any goroutine: sockets stay in the network namespace they were
+// created in.
+func dialInNetns(netnsPath, network string, addresses ...string) (net.Conn, error) {
+	targetNs, err := os.Open(netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer targetNs.Close()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 1)
+	// The namespace is switched in a goroutine of its own, so it can be
+	// parked along with its thread if the thread can't be switched back.
+	go func() {
+		// Namespaces are per thread, make sure this goroutine stays on
+		// this one.
+		goruntime.LockOSThread()
+
+		origNs, err := os.Open(filepath.Join(util.ProcRoot, "self", "task", strconv.Itoa(syscall.Gettid()), "ns", "net"))
+		if err != nil {
+			goruntime.UnlockOSThread()
+			results <- result{nil, err}
+			return
+		}
+		defer origNs.Close()
+
+		if err := unix.Setns(int(targetNs.Fd()), unix.CLONE_NEWNET); err != nil {
+			goruntime.UnlockOSThread()
+			results <- result{nil, fmt.Errorf("unable to enter network namespace %q: %v", netnsPath, err)}
+			return
+		}
+
+		var conn net.Conn
+		var dialErr error
+		for _, address := range addresses {
+			if conn, dialErr = net.Dial(network, address); dialErr == nil {
+				break
+			}
+		}
+
+		if err := unix.Setns(int(origNs.Fd()), unix.CLONE_NEWNET); err != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			results <- result{nil, fmt.Errorf("unable to restore network namespace: %v", err)}
+			// Before Go 1.10, the thread of an exiting goroutine is
+			// unlocked and reused even if it was locked, so the goroutine
+			// never exits: its thread must not run anything else in the
+			// wrong network namespace.
+			glog.Errorf("rkt: thread %d left in network namespace %q, parking it", syscall.Gettid(), netnsPath)
+			select {}
+		}
+		goruntime.UnlockOSThread()
+		results <- result{conn, dialErr}
+	}()
+
+	res := <-results
+	return res.conn, res.err
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortForward(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("entering a network namespace requires root")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "rktlet_portforward")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	es := NewExecShim(nil, filepath.Join(tmpDir, "data"))
+	writeFile(t, filepath.Join(podDir(es.dataDir, "1234"), "pid"), strconv.Itoa(os.Getpid()))
+
+	for _, address := range []string{"127.0.0.1:0", "[::1]:0"} {
+		// An echo server in our own network namespace, which the fake pod
+		// shares.
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Logf("unable to listen on %s, skipping: %v", address, err)
+			continue
+		}
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			io.Copy(conn, conn)
+			conn.Close()
+		}()
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		client, server := net.Pipe()
+		done := make(chan error)
+		go func() {
+			done <- es.PortForward("1234", int32(port), server)
+		}()
+
+		if _, err := client.Write([]byte("hello")); err != nil {
+			t.Fatalf("unable to write to stream: %v", err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatalf("unable to read from stream: %v", err)
+		}
+		assert.Equal(t, "hello", string(buf), address)
+
+		client.Close()
+		assert.NoError(t, <-done, address)
+		listener.Close()
+	}
+}
+
+func TestNetnsPath(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_netns")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	es := NewExecShim(nil, tmpDir)
+
+	writeFile(t, filepath.Join(podDir(tmpDir, "1234"), "pid"), "42\n")
+	path, err := es.netnsPath("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "/proc/42/ns/net", path)
+
+	writeFile(t, filepath.Join(podDir(tmpDir, "1234"), "netns"), "/var/run/netns/cni-1234")
+	path, err = es.netnsPath("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/run/netns/cni-1234", path)
+
+	_, err = es.netnsPath("5678")
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	appcschema "github.com/appc/spec/schema"
+	actypes "github.com/appc/spec/schema/types"
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// cfsPeriodUs is the CFS period systemd (and therefore rkt) configures
+	// when given a CPU quota.
+	cfsPeriodUs = 100000
+
+	// podManifestLockFile is the file in the pod directory rkt locks while
+	// it changes the manifest of a pod, as the pod directory itself is
+	// locked for as long as the pod runs.
+	podManifestLockFile = "pod.lck"
+)
+
+// UpdateContainerResources updates ContainerConfig of the container.
+// The new resources are applied to the cgroup of the running app, and
+// recorded in the pod manifest so they're kept if the app is restarted.
+func (r *RktRuntime) UpdateContainerResources(ctx context.Context, req *runtimeApi.UpdateContainerResourcesRequest) (*runtimeApi.UpdateContainerResourcesResponse, error) {
+	// Container ID is in the form of "uuid:appName".
+	uuid, appName, err := parseContainerID(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := req.GetLinux()
+	if resources == nil {
+		return &runtimeApi.UpdateContainerResourcesResponse{}, nil
+	}
+
+	unlock, err := r.lockSandbox(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// The cgroup is updated first, so the manifest isn't changed if the
+	// resources can't be applied.
+	if err := r.applyAppCgroupResources(uuid, appName, resources); err != nil {
+		return nil, cli.WrapError(err, "unable to update resources of app %q in pod %q", appName, uuid)
+	}
+	if err := r.updateAppManifestResources(uuid, appName, resources); err != nil {
+		return nil, cli.WrapError(err, "unable to record resources of app %q in pod %q", appName, uuid)
+	}
+
+	return &runtimeApi.UpdateContainerResourcesResponse{}, nil
+}
+
+// updateAppManifestResources replaces the resource isolators of an app in the
+// pod manifest, the same way `rkt app add` would have set them from the flags
+// built by generateAppAddCommand.
+func (r *RktRuntime) updateAppManifestResources(uuid, appName string, resources *runtimeApi.LinuxContainerResources) error {
+	unlock, err := r.lockPodManifest(uuid)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	manifest, err := r.readPodManifest(uuid)
+	if err != nil {
+		return err
+	}
+
+	var app *appcschema.RuntimeApp
+	for i := range manifest.Apps {
+		if manifest.Apps[i].Name.String() == appName {
+			app = &manifest.Apps[i]
+			break
+		}
+	}
+	if app == nil || app.App == nil {
+		return fmt.Errorf("app %q not found in pod manifest", appName)
+	}
+	isolators := &app.App.Isolators
+
+	if resources.CpuShares > 0 {
+		shares, err := actypes.NewLinuxCPUShares(int(resources.CpuShares))
+		if err != nil {
+			return err
+		}
+		isolators.ReplaceIsolatorsByName(shares.AsIsolator(), []actypes.ACIdentifier{actypes.LinuxCPUSharesName})
+	}
+	if cpuMilliCores := cpuQuotaToMilliCores(resources.CpuQuota, resources.CpuPeriod); cpuMilliCores > 0 {
+		quantity := fmt.Sprintf("%dm", cpuMilliCores)
+		cpu, err := actypes.NewResourceCPUIsolator(quantity, quantity)
+		if err != nil {
+			return err
+		}
+		isolators.ReplaceIsolatorsByName(cpu.AsIsolator(), []actypes.ACIdentifier{actypes.ResourceCPUName})
+	}
+	if resources.MemoryLimitInBytes != 0 {
+		quantity := strconv.FormatInt(resources.MemoryLimitInBytes, 10)
+		memory, err := actypes.NewResourceMemoryIsolator(quantity, quantity)
+		if err != nil {
+			return err
+		}
+		isolators.ReplaceIsolatorsByName(memory.AsIsolator(), []actypes.ACIdentifier{actypes.ResourceMemoryName})
+	}
+	if resources.OomScoreAdj != 0 {
+		oomScoreAdj, err := actypes.NewLinuxOOMScoreAdj(int(resources.OomScoreAdj))
+		if err != nil {
+			return err
+		}
+		isolators.ReplaceIsolatorsByName(oomScoreAdj.AsIsolator(), []actypes.ACIdentifier{actypes.LinuxOOMScoreAdjName})
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod manifest: %v", err)
+	}
+
+	// Write to a temporary file first so rkt never reads a partial manifest.
+	manifestPath := filepath.Join(r.podDir(uuid), "pod")
+	tmpPath := manifestPath + ".rktlet"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, manifestPath)
+}
+
+// lockPodManifest takes the lock rkt takes to change the manifest of a pod
+// which may be running, e.g. to add an app, and returns the function
+// releasing it.
+func (r *RktRuntime) lockPodManifest(uuid string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(r.podDir(uuid), podManifestLockFile), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open manifest lock: %v", err)
+	}
+	for {
+		err = unix.Flock(int(f.Fd()), unix.LOCK_EX)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock pod manifest: %v", err)
+	}
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
+
+// applyAppCgroupResources writes the resources into the cgroup of a running
+// app, and adjusts the oom score of the processes in it.
+func (r *RktRuntime) applyAppCgroupResources(uuid, appName string, resources *runtimeApi.LinuxContainerResources) error {
+	cgroupPath, err := r.appCgroupPath(uuid, appName)
+	if err != nil {
+		return err
+	}
+
+	if resources.CpuShares > 0 {
+		if err := writeCgroupFile("cpu", cgroupPath, "cpu.shares", strconv.FormatInt(resources.CpuShares, 10)); err != nil {
+			return err
+		}
+	}
+	if cpuMilliCores := cpuQuotaToMilliCores(resources.CpuQuota, resources.CpuPeriod); cpuMilliCores > 0 {
+		if err := writeCgroupFile("cpu", cgroupPath, "cpu.cfs_period_us", strconv.Itoa(cfsPeriodUs)); err != nil {
+			return err
+		}
+		quota := cpuMilliCores * cfsPeriodUs / 1000
+		if err := writeCgroupFile("cpu", cgroupPath, "cpu.cfs_quota_us", strconv.FormatInt(quota, 10)); err != nil {
+			return err
+		}
+	}
+	if resources.MemoryLimitInBytes != 0 {
+		if err := writeCgroupFile("memory", cgroupPath, "memory.limit_in_bytes", strconv.FormatInt(resources.MemoryLimitInBytes, 10)); err != nil {
+			return err
+		}
+	}
+	if resources.OomScoreAdj != 0 {
+		pids, err := r.appPids(uuid, appName)
+		if err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			oomScoreAdjPath := filepath.Join(util.ProcRoot, strconv.Itoa(pid), "oom_score_adj")
+			if err := ioutil.WriteFile(oomScoreAdjPath, []byte(strconv.FormatInt(resources.OomScoreAdj, 10)), 0644); err != nil {
+				// The process may have exited in the meantime.
+				glog.Warningf("rkt: unable to set oom_score_adj of process %d: %v", pid, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appcschema "github.com/appc/spec/schema"
+	actypes "github.com/appc/spec/schema/types"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read %q: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestUpdateContainerResources(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_resources")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot, origProcRoot := util.CgroupRoot, util.ProcRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	util.ProcRoot = filepath.Join(tmpDir, "proc")
+	defer func() { util.CgroupRoot, util.ProcRoot = origCgroupRoot, origProcRoot }()
+
+	r := &RktRuntime{dataDir: filepath.Join(tmpDir, "data")}
+	podDir := r.podDir("1234")
+	appCgroup := "rktlet-abc.service/system.slice/0-foo.service"
+
+	manifest := appcschema.BlankPodManifest()
+	manifest.Apps = appcschema.AppList{{
+		Name:  *actypes.MustACName("0-foo"),
+		Image: appcschema.RuntimeImage{ID: *actypes.NewHashSHA512([]byte("image"))},
+		App: &actypes.App{
+			Exec:  actypes.Exec{"/bin/sh"},
+			User:  "0",
+			Group: "0",
+		},
+	}}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("unable to marshal pod manifest: %v", err)
+	}
+
+	writeFile(t, filepath.Join(podDir, "pod"), string(manifestData))
+	writeFile(t, filepath.Join(podDir, "subcgroup"), "rktlet-abc.service")
+	writeFile(t, filepath.Join(util.CgroupRoot, "cpu", appCgroup, "cpu.shares"), "1024")
+	writeFile(t, filepath.Join(util.CgroupRoot, "memory", appCgroup, "cgroup.procs"), "42\n")
+	writeFile(t, filepath.Join(util.ProcRoot, "42", "oom_score_adj"), "0")
+
+	_, err = r.UpdateContainerResources(context.TODO(), &runtimeApi.UpdateContainerResourcesRequest{
+		ContainerId: "1234:0-foo",
+		Linux: &runtimeApi.LinuxContainerResources{
+			CpuShares:          512,
+			CpuQuota:           50000,
+			CpuPeriod:          100000,
+			MemoryLimitInBytes: 1 << 20,
+			OomScoreAdj:        500,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assert.Equal(t, "512", readFile(t, filepath.Join(util.CgroupRoot, "cpu", appCgroup, "cpu.shares")))
+	assert.Equal(t, "100000", readFile(t, filepath.Join(util.CgroupRoot, "cpu", appCgroup, "cpu.cfs_period_us")))
+	assert.Equal(t, "50000", readFile(t, filepath.Join(util.CgroupRoot, "cpu", appCgroup, "cpu.cfs_quota_us")))
+	assert.Equal(t, "1048576", readFile(t, filepath.Join(util.CgroupRoot, "memory", appCgroup, "memory.limit_in_bytes")))
+	assert.Equal(t, "500", readFile(t, filepath.Join(util.ProcRoot, "42", "oom_score_adj")))
+
+	var updated appcschema.PodManifest
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(podDir, "pod"))), &updated); err != nil {
+		t.Fatalf("unable to unmarshal pod manifest: %v", err)
+	}
+	isolators := updated.Apps[0].App.Isolators
+
+	shares, ok := isolators.GetByName(actypes.LinuxCPUSharesName).Value().(*actypes.LinuxCPUShares)
+	assert.True(t, ok)
+	assert.Equal(t, actypes.LinuxCPUShares(512), *shares)
+
+	cpu, ok := isolators.GetByName(actypes.ResourceCPUName).Value().(*actypes.ResourceCPU)
+	assert.True(t, ok)
+	assert.Equal(t, int64(500), cpu.Limit().MilliValue())
+
+	memory, ok := isolators.GetByName(actypes.ResourceMemoryName).Value().(*actypes.ResourceMemory)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1<<20), memory.Limit().Value())
+
+	oomScoreAdj, ok := isolators.GetByName(actypes.LinuxOOMScoreAdjName).Value().(*actypes.LinuxOOMScoreAdj)
+	assert.True(t, ok)
+	assert.Equal(t, actypes.LinuxOOMScoreAdj(500), *oomScoreAdj)
+
+	// The manifest is left alone when the cgroup can't be updated.
+	os.RemoveAll(filepath.Join(util.CgroupRoot, "cpu", appCgroup))
+	manifestData = []byte(readFile(t, filepath.Join(podDir, "pod")))
+	_, err = r.UpdateContainerResources(context.TODO(), &runtimeApi.UpdateContainerResourcesRequest{
+		ContainerId: "1234:0-foo",
+		Linux:       &runtimeApi.LinuxContainerResources{CpuShares: 256},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, string(manifestData), readFile(t, filepath.Join(podDir, "pod")))
+}
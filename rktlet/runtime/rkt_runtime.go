@@ -17,15 +17,17 @@ limitations under the License.
 package runtime
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
 	"github.com/kubernetes-incubator/rktlet/rktlet/util"
-	rkt "github.com/rkt/rkt/api/v1"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 
 	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 	"k8s.io/kubernetes/pkg/kubelet/server/streaming"
@@ -34,35 +36,102 @@ import (
 type RktRuntime struct {
 	cli.CLI
 	cli.Init
+	// reader reads pods, by running rkt or from its api-service.
+	reader cli.Reader
 
 	execShim          *execShim
 	streamServer      streaming.Server
 	imageStore        runtimeApi.ImageServiceServer
 	stage1Name        string
 	networkPluginName string
+	// localConfigDir is the local configuration directory of rkt, see
+	// networkConfigDir.
+	localConfigDir string
+	// networkConfigLock serializes the updates of the network configuration
+	// written by UpdateRuntimeConfig.
+	networkConfigLock sync.Mutex
+	dataDir           string
+	execOutputLimit   int64
+	rktVersion        string
+	// podReadyTimeout is how long RunPodSandbox waits for a new pod to be
+	// ready.
+	podReadyTimeout time.Duration
+
+	// sandboxLocks serializes the calls changing the same pod, e.g. adding an
+	// app while the pod is being stopped. Reads don't take them.
+	sandboxLocks util.KeyedMutex
+
+	// podCache holds the pods and apps served by the list calls.
+	podCache *util.ListCache
+	// podWatcher notifies of changes to pods made outside of rktlet, e.g.
+	// pods exiting. It's nil if the pods can't be watched.
+	podWatcher *podWatcher
+
+	// oomWatcher records the apps running out of memory. It's nil if OOM
+	// events can't be watched.
+	oomWatcher *oomWatcher
+
+	// layerUsage caches the disk usage of the writable layers of apps
+	// reported by the stats calls.
+	layerUsage *layerUsageCache
 }
 
 const internalAppPrefix = "rktletinternal-"
 
+// lockSandbox locks the pod with the given UUID against other changes, and
+// returns the function unlocking it. It gives up if the context is done
+// first, e.g. while a stuck call holds the lock.
+func (r *RktRuntime) lockSandbox(ctx context.Context, uuid string) (func(), error) {
+	unlock, err := r.sandboxLocks.LockContext(ctx, uuid)
+	if err != nil {
+		code := codes.DeadlineExceeded
+		if err == context.Canceled {
+			code = codes.Canceled
+		}
+		return nil, grpcstatus.Errorf(code, "gave up waiting for other changes to pod %q: %v", uuid, err)
+	}
+	return unlock, nil
+}
+
 // New creates a new RuntimeServiceServer backed by rkt
 func New(
 	cli cli.CLI,
+	reader cli.Reader,
 	init cli.Init,
 	imageStore runtimeApi.ImageServiceServer,
 	streamServerAddr string,
 	stage1Name string,
 	networkPluginName string,
+	localConfigDir string,
+	dataDir string,
+	execOutputLimit int64,
+	stateCacheRefreshPeriod time.Duration,
+	podReadyTimeout time.Duration,
 ) (runtimeApi.RuntimeServiceServer, error) {
+	if podReadyTimeout == 0 {
+		podReadyTimeout = DefaultPodReadyTimeout
+	}
 	runtime := &RktRuntime{
 		CLI:               cli,
 		Init:              init,
+		reader:            reader,
 		imageStore:        imageStore,
-		execShim:          NewExecShim(cli),
+		execShim:          NewExecShim(cli, dataDir),
 		stage1Name:        stage1Name,
 		networkPluginName: networkPluginName,
+		localConfigDir:    localConfigDir,
+		dataDir:           dataDir,
+		execOutputLimit:   execOutputLimit,
+		podReadyTimeout:   podReadyTimeout,
+		layerUsage:        newLayerUsageCache(defaultLayerUsageRefreshPeriod),
 	}
+	runtime.podCache = newPodCache(runtime, stateCacheRefreshPeriod)
 
 	var err error
+	if runtime.rktVersion, err = checkRktVersion(cli); err != nil {
+		return nil, err
+	}
+
 	streamConfig := streaming.DefaultConfig
 	streamConfig.Addr = streamServerAddr
 	runtime.streamServer, err = streaming.NewServer(streamConfig, runtime.execShim)
@@ -83,18 +152,24 @@ func New(
 		return nil, err
 	}
 
-	return runtime, nil
-}
+	runtime.podWatcher, err = newPodWatcher(dataDir, func(podEvent) { runtime.invalidatePods() })
+	if err != nil {
+		glog.Warningf("rkt: unable to watch pods, relying on periodic relists: %v", err)
+	} else {
+		go runtime.podWatcher.run()
+	}
+	go runtime.podCache.Run()
 
-func (r *RktRuntime) Version(ctx context.Context, req *runtimeApi.VersionRequest) (*runtimeApi.VersionResponse, error) {
-	name := "rkt"
-	version := "0.1.0"
-	return &runtimeApi.VersionResponse{
-		Version:           version, // kubelet/remote version, must be 0.1.0
-		RuntimeName:       name,
-		RuntimeVersion:    version, // todo, rkt version
-		RuntimeApiVersion: version, // todo, rkt version
-	}, nil
+	runtime.oomWatcher, err = newOOMWatcher(runtime.recordAppOOM)
+	if err != nil {
+		glog.Warningf("rkt: unable to watch OOM events, relying on the OOM kill count of running apps: %v", err)
+	} else {
+		go runtime.oomWatcher.run()
+		// The apps started before a restart of rktlet aren't watched yet.
+		go runtime.watchRunningAppsOOM(context.Background())
+	}
+
+	return runtime, nil
 }
 
 func (r *RktRuntime) ContainerStatus(ctx context.Context, req *runtimeApi.ContainerStatusRequest) (*runtimeApi.ContainerStatusResponse, error) {
@@ -104,24 +179,18 @@ func (r *RktRuntime) ContainerStatus(ctx context.Context, req *runtimeApi.Contai
 		return nil, err
 	}
 
-	resp, err := r.RunCommand("app", "status", uuid, "--app="+appName, "--format=json")
+	app, err := r.appStatus(ctx, uuid, appName)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp) != 1 {
-		return nil, fmt.Errorf("unexpected result %q", resp)
-	}
-
-	var app rkt.App
-	if err := json.Unmarshal([]byte(resp[0]), &app); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal container: %v", err)
-	}
-
-	status, err := toContainerStatus(uuid, &app)
+	status, err := toContainerStatus(uuid, app)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert to container status: %v", err)
 	}
+	if status.State == runtimeApi.ContainerState_CONTAINER_EXITED {
+		r.setTerminationStatus(uuid, appName, status)
+	}
 	return &runtimeApi.ContainerStatusResponse{Status: status}, nil
 }
 
@@ -137,12 +206,20 @@ func (r *RktRuntime) CreateContainer(ctx context.Context, req *runtimeApi.Create
 		return nil, fmt.Errorf("unable to apply default tag for img %q, %v", imageID, err)
 	}
 
+	unlock, err := r.lockSandbox(ctx, req.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	command, err := generateAppAddCommand(req, imageID)
 	if err != nil {
 		return nil, err
 	}
-	if output, err := r.RunCommand(command[0], command[1:]...); err != nil {
-		return nil, fmt.Errorf("output: %s\n, err: %v", output, err)
+	output, err := r.RunCommandContext(ctx, command[0], command[1:]...)
+	r.invalidatePods()
+	if err != nil {
+		return nil, cli.WrapError(err, "failed to add app to pod %q, output: %s\n", req.PodSandboxId, output)
 	}
 
 	appName, err := buildAppName(req.Config.Metadata.Attempt, req.Config.Metadata.Name)
@@ -161,9 +238,18 @@ func (r *RktRuntime) StartContainer(ctx context.Context, req *runtimeApi.StartCo
 		return nil, err
 	}
 
-	if output, err := r.RunCommand("app", "start", uuid, "--app="+appName); err != nil {
-		return nil, fmt.Errorf("output: %s\n, err: %v", output, err)
+	unlock, err := r.lockSandbox(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	output, err := r.RunCommandContext(ctx, "app", "start", uuid, "--app="+appName)
+	r.invalidatePods()
+	if err != nil {
+		return nil, cli.WrapError(err, "failed to start app %q of pod %q, output: %s\n", appName, uuid, output)
 	}
+	r.watchAppOOM(uuid, appName)
 	return &runtimeApi.StartContainerResponse{}, nil
 }
 
@@ -174,60 +260,54 @@ func (r *RktRuntime) StopContainer(ctx context.Context, req *runtimeApi.StopCont
 		return nil, err
 	}
 
-	// TODO(yifan): Support timeout.
-	if output, err := r.RunCommand("app", "stop", uuid, "--app="+appName); err != nil {
-		return nil, fmt.Errorf("output: %s\n, err: %v", output, err)
+	unlock, err := r.lockSandbox(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = r.stopApp(ctx, uuid, appName, time.Duration(req.Timeout)*time.Second)
+	r.invalidatePods()
+	if err != nil {
+		return nil, err
 	}
 	return &runtimeApi.StopContainerResponse{}, nil
 }
 
 func (r *RktRuntime) ListContainers(ctx context.Context, req *runtimeApi.ListContainersRequest) (*runtimeApi.ListContainersResponse, error) {
 	// We assume the containers in data dir are all managed by kubelet.
-	resp, err := r.RunCommand("list", "--format=json")
+	pods, err := r.listPods(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp) != 1 {
-		return nil, fmt.Errorf("unexpected result %q", resp)
-	}
-
-	var pods []rkt.Pod
-	if err := json.Unmarshal([]byte(resp[0]), &pods); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal pods: %v", err)
-	}
-
-	// TODO(yifan): Could optimize this so that we don't have to check ContainerStatus on every container.
 	var containers []*runtimeApi.Container
-	for _, p := range pods {
-		p := p
-		if !isKubernetesPod(&p) {
+	for i := range pods {
+		p := &pods[i]
+		if !isKubernetesPod(p) {
 			glog.V(6).Infof("Skipping non-kubernetes pod %s", p.UUID)
 			continue
 		}
-		for _, appName := range p.AppNames {
-			if strings.HasPrefix(appName, internalAppPrefix) {
+		for _, app := range p.Apps {
+			if strings.HasPrefix(app.Name, internalAppPrefix) {
 				continue
 			}
-			containerID := buildContainerID(p.UUID, appName)
-			resp, err := r.ContainerStatus(ctx, &runtimeApi.ContainerStatusRequest{
-				ContainerId: containerID,
-			})
+			status, err := toContainerStatus(p.UUID, app)
 			if err != nil {
-				glog.Warningf("rkt: cannot get container status for pod %q, app %q: %v", p.UUID, appName, err)
+				glog.Warningf("rkt: cannot get container status for pod %q, app %q: %v", p.UUID, app.Name, err)
 				continue
 			}
 
 			container := &runtimeApi.Container{
-				Annotations:  resp.Status.Annotations,
-				CreatedAt:    resp.Status.CreatedAt,
-				Id:           resp.Status.Id,
-				Image:        resp.Status.Image,
-				ImageRef:     resp.Status.ImageRef,
-				Labels:       resp.Status.Labels,
-				Metadata:     resp.Status.Metadata,
+				Annotations:  status.Annotations,
+				CreatedAt:    status.CreatedAt,
+				Id:           status.Id,
+				Image:        status.Image,
+				ImageRef:     status.ImageRef,
+				Labels:       status.Labels,
+				Metadata:     status.Metadata,
 				PodSandboxId: p.UUID,
-				State:        resp.Status.State,
+				State:        status.State,
 			}
 
 			if passFilter(container, req.Filter) {
@@ -246,57 +326,21 @@ func (r *RktRuntime) RemoveContainer(ctx context.Context, req *runtimeApi.Remove
 		return nil, err
 	}
 
-	// TODO(yifan): Support timeout.
-	if output, err := r.RunCommand("app", "rm", uuid, "--app="+appName); err != nil {
-		return nil, fmt.Errorf("output: %s\n, err: %v", output, err)
+	unlock, err := r.lockSandbox(ctx, uuid)
+	if err != nil {
+		return nil, err
 	}
-	return &runtimeApi.RemoveContainerResponse{}, nil
-}
-
-func (r *RktRuntime) UpdateRuntimeConfig(ctx context.Context, req *runtimeApi.UpdateRuntimeConfigRequest) (*runtimeApi.UpdateRuntimeConfigResponse, error) {
-	// TODO, use the PodCIDR passed in once we have network plugins setup
-	return &runtimeApi.UpdateRuntimeConfigResponse{}, nil
-}
-
-func (r *RktRuntime) Status(ctx context.Context, req *runtimeApi.StatusRequest) (*runtimeApi.StatusResponse, error) {
-	// TODO: implement
-
-	//Need to copy the consts to get pointers
-	runtimeReady := runtimeApi.RuntimeReady
-	networkReady := runtimeApi.NetworkReady
-	tv := true
-
-	conditions := []*runtimeApi.RuntimeCondition{
-		&runtimeApi.RuntimeCondition{
-			Type:   runtimeReady,
-			Status: tv,
-		},
-		&runtimeApi.RuntimeCondition{
-			Type:   networkReady,
-			Status: tv,
-		},
+	defer unlock()
+
+	output, err := r.RunCommandContext(ctx, "app", "rm", uuid, "--app="+appName)
+	r.invalidatePods()
+	if cli.IsErrorKind(err, cli.ErrNotFound) {
+		// Removing is idempotent.
+		glog.V(4).Infof("rkt: container %q already removed: %v", req.ContainerId, err)
+		return &runtimeApi.RemoveContainerResponse{}, nil
 	}
-	resp := runtimeApi.StatusResponse{
-		Status: &runtimeApi.RuntimeStatus{
-			Conditions: conditions,
-		},
+	if err != nil {
+		return nil, cli.WrapError(err, "failed to remove container %q, output: %s\n", req.ContainerId, output)
 	}
-
-	return &resp, nil
-}
-
-// ContainerStats returns stats of the container. If the container does not
-// exist, the call returns an error.
-func (r *RktRuntime) ContainerStats(ctx context.Context, req *runtimeApi.ContainerStatsRequest) (*runtimeApi.ContainerStatsResponse, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-// ListContainerStats returns stats of all running containers.
-func (r *RktRuntime) ListContainerStats(ctx context.Context, req *runtimeApi.ListContainerStatsRequest) (*runtimeApi.ListContainerStatsResponse, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-// UpdateContainerResources updates ContainerConfig of the container.
-func (r *RktRuntime) UpdateContainerResources(ctx context.Context, req *runtimeApi.UpdateContainerResourcesRequest) (*runtimeApi.UpdateContainerResourcesResponse, error) {
-	return nil, fmt.Errorf("not implemented")
+	return &runtimeApi.RemoveContainerResponse{}, nil
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
 )
 
 func (r *RktRuntime) fetchStage1Image(ctx context.Context) error {
@@ -33,14 +34,17 @@ func (r *RktRuntime) fetchStage1Image(ctx context.Context) error {
 	}
 
 	glog.Infof("downloading %q stage1 image, this may take some time", r.stage1Name)
-	output, err := r.RunCommand("image", "fetch", "--pull-policy=update", "--full=true", r.stage1Name)
+	output, err := r.RunCommandContext(ctx, "image", "fetch", "--pull-policy=update", "--full=true", r.stage1Name)
 	if err != nil {
-		return fmt.Errorf("unable to fetch image %q: %v", r.stage1Name, err)
+		return cli.WrapError(err, "unable to fetch image %q", r.stage1Name)
 	}
 	if len(output) < 1 {
 		return fmt.Errorf("malformed fetch image response for %q; must include image id: %v", r.stage1Name, output)
 	}
 	glog.Infof("finished downloading stage1 image")
+	if invalidator, ok := r.imageStore.(imageCacheInvalidator); ok {
+		invalidator.InvalidateImageCache()
+	}
 
 	return err
 }
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	rkt "github.com/rkt/rkt/api/v1"
+	"golang.org/x/net/context"
+)
+
+// DefaultStateCacheRefreshPeriod is how often the pods and apps are relisted,
+// unless configured otherwise. It matches how often the kubelet relists.
+const DefaultStateCacheRefreshPeriod = time.Second
+
+// imageCacheInvalidator is implemented by image stores caching the list of
+// images, so they can be told about images fetched by the runtime itself.
+type imageCacheInvalidator interface {
+	InvalidateImageCache()
+}
+
+// newPodCache creates the cache of the pods and apps the list calls are
+// served from.
+func newPodCache(r *RktRuntime, refreshPeriod time.Duration) *util.ListCache {
+	if refreshPeriod == 0 {
+		refreshPeriod = DefaultStateCacheRefreshPeriod
+	}
+	return util.NewListCache(r.rktListPods, refreshPeriod)
+}
+
+// listPods returns all the rkt pods, with their apps, from the cache. The
+// returned pods must not be modified.
+func (r *RktRuntime) listPods(ctx context.Context) ([]rkt.Pod, error) {
+	pods, err := r.podCache.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pods.([]rkt.Pod), nil
+}
+
+// invalidatePods must be called after every change to pods or apps made by
+// rktlet, so the next list reflects it.
+func (r *RktRuntime) invalidatePods() {
+	r.podCache.Invalidate()
+}
+
+// rktListPods lists the pods with `rkt list`, or from the api-service.
+func (r *RktRuntime) rktListPods(ctx context.Context) (interface{}, error) {
+	return r.reader.ListPods(ctx)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	rktlib "github.com/rkt/rkt/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestListContainersFromCache(t *testing.T) {
+	pods := []rktlib.Pod{{
+		UUID:     "1",
+		AppNames: []string{"0-foo", internalAppPrefix + "bar"},
+		Apps: []*rktlib.App{
+			{Name: "0-foo", State: rktlib.AppStateRunning, ImageID: "sha512-foo", CreatedAt: int64ptr(100)},
+			{Name: internalAppPrefix + "bar", State: rktlib.AppStateRunning},
+		},
+		UserAnnotations: map[string]string{
+			kubernetesReservedAnnoPodName:      "foo",
+			kubernetesReservedAnnoPodUid:       "0",
+			kubernetesReservedAnnoPodAttempt:   "0",
+			kubernetesReservedAnnoPodNamespace: "default",
+		},
+		State: "running",
+	}, {
+		// Not a kubernetes pod.
+		UUID:  "2",
+		Apps:  []*rktlib.App{{Name: "0-foo", State: rktlib.AppStateRunning}},
+		State: "running",
+	}}
+	podsJson, err := json.Marshal(pods)
+	if err != nil {
+		t.Fatalf("could not marshal pods: %v", err)
+	}
+
+	mockCli := new(mocks.CLI)
+	mockCli.On("RunCommandContext", mock.Anything, "list", []string{"--format=json"}).Return([]string{string(podsJson)}, nil)
+	mockCli.On("RunCommandContext", mock.Anything, "app", []string{"rm", "1", "--app=0-foo"}).Return(nil, nil)
+	r := &RktRuntime{CLI: mockCli, reader: cli.NewCLIReader(mockCli)}
+	r.podCache = newPodCache(r, time.Minute)
+
+	expected := []*runtimeApi.Container{{
+		Id:           "1:0-foo",
+		PodSandboxId: "1",
+		Metadata:     &runtimeApi.ContainerMetadata{Name: "foo"},
+		Image:        &runtimeApi.ImageSpec{},
+		ImageRef:     "sha512-foo",
+		State:        runtimeApi.ContainerState_CONTAINER_RUNNING,
+		CreatedAt:    100,
+	}}
+
+	// The apps come with the pods, and repeated lists are served from the
+	// cache.
+	for i := 0; i < 3; i++ {
+		resp, err := r.ListContainers(context.TODO(), &runtimeApi.ListContainersRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert.Equal(t, expected, resp.Containers)
+	}
+	mockCli.AssertNumberOfCalls(t, "RunCommandContext", 1)
+
+	// Changes made by rktlet are visible right away.
+	_, err = r.RemoveContainer(context.TODO(), &runtimeApi.RemoveContainerRequest{ContainerId: "1:0-foo"})
+	assert.NoError(t, err)
+	_, err = r.ListContainers(context.TODO(), &runtimeApi.ListContainersRequest{})
+	assert.NoError(t, err)
+	// Another list, on top of the app rm.
+	mockCli.AssertNumberOfCalls(t, "RunCommandContext", 3)
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// ContainerStats returns stats of the container. If the container does not
+// exist, the call returns an error.
+func (r *RktRuntime) ContainerStats(ctx context.Context, req *runtimeApi.ContainerStatsRequest) (*runtimeApi.ContainerStatsResponse, error) {
+	uuid, appName, err := parseContainerID(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.ContainerStatus(ctx, &runtimeApi.ContainerStatusRequest{ContainerId: req.ContainerId})
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := r.appStats(uuid, appName, &runtimeApi.ContainerAttributes{
+		Id:          resp.Status.Id,
+		Metadata:    resp.Status.Metadata,
+		Labels:      resp.Status.Labels,
+		Annotations: resp.Status.Annotations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeApi.ContainerStatsResponse{Stats: stats}, nil
+}
+
+// ListContainerStats returns stats of all running containers.
+func (r *RktRuntime) ListContainerStats(ctx context.Context, req *runtimeApi.ListContainerStatsRequest) (*runtimeApi.ListContainerStatsResponse, error) {
+	filter := &runtimeApi.ContainerFilter{
+		State: &runtimeApi.ContainerStateValue{State: runtimeApi.ContainerState_CONTAINER_RUNNING},
+	}
+	if f := req.GetFilter(); f != nil {
+		filter.Id = f.Id
+		filter.PodSandboxId = f.PodSandboxId
+		filter.LabelSelector = f.LabelSelector
+	}
+
+	resp, err := r.ListContainers(ctx, &runtimeApi.ListContainersRequest{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []*runtimeApi.ContainerStats
+	for _, c := range resp.Containers {
+		uuid, appName, err := parseContainerID(c.Id)
+		if err != nil {
+			glog.Warningf("rkt: unexpected container id %q: %v", c.Id, err)
+			continue
+		}
+
+		s, err := r.appStats(uuid, appName, &runtimeApi.ContainerAttributes{
+			Id:          c.Id,
+			Metadata:    c.Metadata,
+			Labels:      c.Labels,
+			Annotations: c.Annotations,
+		})
+		if err != nil {
+			glog.Warningf("rkt: cannot get stats for pod %q, app %q: %v", uuid, appName, err)
+			continue
+		}
+		stats = append(stats, s)
+	}
+
+	return &runtimeApi.ListContainerStatsResponse{Stats: stats}, nil
+}
+
+// appStats gathers the resource usage of an app from its cgroup and from its
+// writable layer on disk, whose usage is cached by layerUsage.
+// Apps which are not running don't have a cgroup anymore, in which case only
+// the writable layer usage is reported.
+func (r *RktRuntime) appStats(uuid, appName string, attributes *runtimeApi.ContainerAttributes) (*runtimeApi.ContainerStats, error) {
+	stats := &runtimeApi.ContainerStats{Attributes: attributes}
+
+	cgroupPath, err := r.appCgroupPath(uuid, appName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if cgroupPath != "" {
+		timestamp := time.Now().UnixNano()
+
+		cpuUsage, err := readCgroupUint64("cpuacct", cgroupPath, "cpuacct.usage")
+		switch {
+		case err == nil:
+			stats.Cpu = &runtimeApi.CpuUsage{
+				Timestamp:            timestamp,
+				UsageCoreNanoSeconds: &runtimeApi.UInt64Value{Value: cpuUsage},
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+
+		workingSet, err := readWorkingSet(cgroupPath)
+		switch {
+		case err == nil:
+			stats.Memory = &runtimeApi.MemoryUsage{
+				Timestamp:       timestamp,
+				WorkingSetBytes: &runtimeApi.UInt64Value{Value: workingSet},
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	if layer := r.appWritableLayer(uuid, appName); layer != "" {
+		stats.WritableLayer, err = r.layerUsage.get(layer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// defaultLayerUsageRefreshPeriod is how long the disk usage of a writable
+// layer is cached for.
+const defaultLayerUsageRefreshPeriod = time.Minute
+
+// layerUsageCache caches the disk usage of the writable layers of apps, which
+// requires walking the whole layer. Like ImageFsInfo, a stale usage is served
+// while it's measured again in the background.
+type layerUsageCache struct {
+	refreshPeriod time.Duration
+
+	lock sync.Mutex
+	// layers are the cached usages by writable layer directory.
+	layers map[string]*layerUsage
+}
+
+type layerUsage struct {
+	usage      *runtimeApi.FilesystemUsage
+	refreshing bool
+	// lastRead is when the usage was last served. Layers which aren't read
+	// anymore, e.g. because their app was removed, are forgotten.
+	lastRead time.Time
+}
+
+func newLayerUsageCache(refreshPeriod time.Duration) *layerUsageCache {
+	return &layerUsageCache{
+		refreshPeriod: refreshPeriod,
+		layers:        make(map[string]*layerUsage),
+	}
+}
+
+// get returns the disk usage of the given writable layer. It's only measured
+// synchronously the first time the layer is seen.
+func (c *layerUsageCache) get(layer string) (*runtimeApi.FilesystemUsage, error) {
+	c.lock.Lock()
+	entry := c.layers[layer]
+	c.lock.Unlock()
+
+	if entry == nil {
+		// Measure without holding the lock, so the stats of the other apps
+		// are still served meanwhile.
+		usage, err := measureLayerUsage(layer)
+		if err != nil {
+			return nil, err
+		}
+		entry = &layerUsage{usage: usage}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if cached := c.layers[layer]; cached != nil {
+		entry = cached
+	} else {
+		c.layers[layer] = entry
+	}
+	entry.lastRead = now
+	if !entry.refreshing && now.Sub(time.Unix(0, entry.usage.Timestamp)) > c.refreshPeriod {
+		entry.refreshing = true
+		go c.refresh(layer)
+	}
+
+	for l, e := range c.layers {
+		if now.Sub(e.lastRead) > 2*c.refreshPeriod {
+			delete(c.layers, l)
+		}
+	}
+
+	return entry.usage, nil
+}
+
+func (c *layerUsageCache) refresh(layer string) {
+	usage, err := measureLayerUsage(layer)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := c.layers[layer]
+	if entry == nil {
+		// Forgotten meanwhile.
+		return
+	}
+	entry.refreshing = false
+	if err != nil {
+		glog.Warningf("rkt: unable to refresh disk usage of %q: %v", layer, err)
+		return
+	}
+	entry.usage = usage
+}
+
+func measureLayerUsage(layer string) (*runtimeApi.FilesystemUsage, error) {
+	bytes, inodes, err := util.DiskUsage(layer)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeApi.FilesystemUsage{
+		Timestamp:  time.Now().UnixNano(),
+		UsedBytes:  &runtimeApi.UInt64Value{Value: bytes},
+		InodesUsed: &runtimeApi.UInt64Value{Value: inodes},
+	}, nil
+}
+
+// readWorkingSet computes the working set of a memory cgroup the same way
+// cAdvisor does: the usage minus the inactive file-backed pages, which the
+// kernel can reclaim easily.
+func readWorkingSet(cgroupPath string) (uint64, error) {
+	usage, err := readCgroupUint64("memory", cgroupPath, "memory.usage_in_bytes")
+	if err != nil {
+		return 0, err
+	}
+	memStat, err := readCgroupKeyedFile("memory", cgroupPath, "memory.stat")
+	if err != nil {
+		return 0, err
+	}
+
+	inactiveFile := memStat["total_inactive_file"]
+	if inactiveFile > usage {
+		return 0, nil
+	}
+	return usage - inactiveFile, nil
+}
+
+// appWritableLayer returns the directory holding the files an app wrote to
+// its root filesystem, or an empty string if it can't be found.
+// With the overlay filesystem, this is the upper directory of the app.
+// Otherwise, the app's rootfs is a full copy of its image, which is the best
+// approximation we have.
+func (r *RktRuntime) appWritableLayer(uuid, appName string) string {
+	podDir := r.podDir(uuid)
+
+	uppers, err := filepath.Glob(filepath.Join(podDir, "overlay", "*", "upper", appName))
+	if err == nil && len(uppers) > 0 {
+		return uppers[0]
+	}
+
+	rootfs := filepath.Join(podDir, "stage1", "rootfs", "opt", "stage2", appName, "rootfs")
+	if _, err := os.Stat(rootfs); err == nil {
+		return rootfs
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/stretchr/testify/assert"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("unable to create %q: %v", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unable to write %q: %v", path, err)
+	}
+}
+
+func TestAppStats(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_stats")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	r := &RktRuntime{
+		dataDir:    filepath.Join(tmpDir, "data"),
+		layerUsage: newLayerUsageCache(time.Minute),
+	}
+	podDir := r.podDir("1234")
+	appCgroup := "kubepods.slice/rktlet-abc.service/system.slice/0-foo.service"
+
+	writeFile(t, filepath.Join(podDir, "subcgroup"), "kubepods.slice/rktlet-abc.service\n")
+	writeFile(t, filepath.Join(util.CgroupRoot, "cpuacct", appCgroup, "cpuacct.usage"), "123456789\n")
+	writeFile(t, filepath.Join(util.CgroupRoot, "memory", appCgroup, "memory.usage_in_bytes"), "10000\n")
+	writeFile(t, filepath.Join(util.CgroupRoot, "memory", appCgroup, "memory.stat"), "cache 4000\ntotal_inactive_file 3000\n")
+	writeFile(t, filepath.Join(podDir, "overlay", "deps-sha512-aaa", "upper", "0-foo", "tmp", "file"), "hello")
+
+	attributes := &runtimeApi.ContainerAttributes{Id: "1234:0-foo"}
+	stats, err := r.appStats("1234", "0-foo", attributes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assert.Equal(t, attributes, stats.Attributes)
+	assert.Equal(t, uint64(123456789), stats.GetCpu().GetUsageCoreNanoSeconds().GetValue())
+	assert.Equal(t, uint64(7000), stats.GetMemory().GetWorkingSetBytes().GetValue())
+	// upper dir, tmp and file
+	assert.Equal(t, uint64(3), stats.GetWritableLayer().GetInodesUsed().GetValue())
+
+	// An exited app doesn't have a cgroup anymore.
+	stats, err = r.appStats("1234", "1-bar", attributes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Nil(t, stats.Cpu)
+	assert.Nil(t, stats.Memory)
+	assert.Nil(t, stats.WritableLayer)
+}
+
+func TestLayerUsageCache(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_stats")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layer := filepath.Join(tmpDir, "upper")
+	writeFile(t, filepath.Join(layer, "a"), "hello")
+
+	c := newLayerUsageCache(time.Hour)
+	usage, err := c.get(layer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, uint64(2), usage.GetInodesUsed().GetValue())
+
+	// Served from the cache until it's stale.
+	writeFile(t, filepath.Join(layer, "b"), "world")
+	usage, err = c.get(layer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, uint64(2), usage.GetInodesUsed().GetValue())
+
+	// A stale usage is still served while it's refreshed in the background.
+	c.lock.Lock()
+	c.layers[layer].usage.Timestamp = time.Now().Add(-2 * time.Hour).UnixNano()
+	c.lock.Unlock()
+	usage, err = c.get(layer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, uint64(2), usage.GetInodesUsed().GetValue())
+
+	for i := 0; i < 100; i++ {
+		if usage, _ = c.get(layer); usage.GetInodesUsed().GetValue() == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(3), usage.GetInodesUsed().GetValue())
+
+	// Layers which aren't read anymore are forgotten.
+	other := filepath.Join(tmpDir, "other")
+	writeFile(t, filepath.Join(other, "a"), "hello")
+	c.lock.Lock()
+	c.layers[layer].lastRead = time.Now().Add(-3 * time.Hour)
+	c.lock.Unlock()
+	if _, err := c.get(other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.lock.Lock()
+	assert.NotContains(t, c.layers, layer)
+	c.lock.Unlock()
+}
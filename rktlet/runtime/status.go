@@ -0,0 +1,158 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// Reasons of the runtime conditions reported by Status when they're not met.
+const (
+	reasonRktNotWorking          = "RktNotWorking"
+	reasonDataDirNotWritable     = "DataDirNotWritable"
+	reasonStage1ImageNotFound    = "Stage1ImageNotFound"
+	reasonInitNotReady           = "InitNotReady"
+	reasonNetworkConfigNotFound  = "NetworkConfigNotFound"
+	reasonNetworkConfigNotLoaded = "NetworkConfigNotLoaded"
+)
+
+// builtinNetworks are the networks rkt provides without any configuration.
+var builtinNetworks = map[string]bool{
+	"":                   true,
+	"default":            true,
+	"default-restricted": true,
+	"host":               true,
+	"none":               true,
+}
+
+// Status returns the status of the runtime. The conditions are checked on
+// every call, so the node goes NotReady as soon as something is wrong.
+func (r *RktRuntime) Status(ctx context.Context, req *runtimeApi.StatusRequest) (*runtimeApi.StatusResponse, error) {
+	runtimeCondition := &runtimeApi.RuntimeCondition{
+		Type:   runtimeApi.RuntimeReady,
+		Status: true,
+	}
+	if reason, err := r.checkRuntimeReady(ctx); err != nil {
+		glog.Warningf("rkt: runtime is not ready: %v", err)
+		runtimeCondition.Status = false
+		runtimeCondition.Reason = reason
+		runtimeCondition.Message = err.Error()
+	}
+
+	networkCondition := &runtimeApi.RuntimeCondition{
+		Type:   runtimeApi.NetworkReady,
+		Status: true,
+	}
+	if reason, err := r.checkNetworkReady(); err != nil {
+		glog.Warningf("rkt: network is not ready: %v", err)
+		networkCondition.Status = false
+		networkCondition.Reason = reason
+		networkCondition.Message = err.Error()
+	}
+
+	return &runtimeApi.StatusResponse{
+		Status: &runtimeApi.RuntimeStatus{
+			Conditions: []*runtimeApi.RuntimeCondition{runtimeCondition, networkCondition},
+		},
+	}, nil
+}
+
+// checkRuntimeReady checks that pods can be run. It returns the reason and a
+// description of the first problem found, if any.
+func (r *RktRuntime) checkRuntimeReady(ctx context.Context) (string, error) {
+	if _, err := r.RunCommandContext(ctx, "version"); err != nil {
+		return reasonRktNotWorking, fmt.Errorf("rkt can't be run: %v", err)
+	}
+
+	if err := checkDirWritable(r.dataDir); err != nil {
+		return reasonDataDirNotWritable, fmt.Errorf("rkt data directory %q is not writable: %v", r.dataDir, err)
+	}
+
+	if r.stage1Name != "" {
+		if _, err := r.getImageHash(ctx, r.stage1Name); err != nil {
+			return reasonStage1ImageNotFound, fmt.Errorf("stage1 image %q is not available: %v", r.stage1Name, err)
+		}
+	}
+
+	if err := r.Init.Ready(); err != nil {
+		return reasonInitNotReady, fmt.Errorf("unable to start pods through the init system: %v", err)
+	}
+
+	return "", nil
+}
+
+// checkNetworkReady checks that rkt has a configuration for the network pods
+// are attached to. It returns the reason and a description of the problem, if
+// any.
+func (r *RktRuntime) checkNetworkReady() (string, error) {
+	if builtinNetworks[r.networkPluginName] {
+		return "", nil
+	}
+
+	// rkt loads all the *.conf files of the directory, and picks networks by
+	// the name set in the configuration rather than by file name.
+	files, err := filepath.Glob(filepath.Join(r.networkConfigDir(), "*.conf"))
+	if err != nil {
+		return reasonNetworkConfigNotLoaded, err
+	}
+	var invalidFiles []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return reasonNetworkConfigNotLoaded, fmt.Errorf("unable to read network configuration %q: %v", file, err)
+		}
+		var conf cnitypes.NetConf
+		if err := json.Unmarshal(data, &conf); err != nil {
+			glog.Warningf("rkt: invalid network configuration %q: %v", file, err)
+			invalidFiles = append(invalidFiles, file)
+			continue
+		}
+		if conf.Name != r.networkPluginName {
+			continue
+		}
+		if conf.Type == "" {
+			return reasonNetworkConfigNotLoaded, fmt.Errorf("network configuration %q for network %q has no plugin type", file, conf.Name)
+		}
+		return "", nil
+	}
+
+	if len(invalidFiles) > 0 {
+		return reasonNetworkConfigNotLoaded, fmt.Errorf("no valid network configuration for network %q in %q, invalid files: %s", r.networkPluginName, r.networkConfigDir(), strings.Join(invalidFiles, ", "))
+	}
+	return reasonNetworkConfigNotFound, fmt.Errorf("no network configuration for network %q in %q", r.networkPluginName, r.networkConfigDir())
+}
+
+// checkDirWritable checks that a file can be created in a directory.
+func checkDirWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".rktlet-check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_status")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	netDir := filepath.Join(tmpDir, "net.d")
+	writeFile(t, filepath.Join(netDir, "10-good.conf"), `{"name": "good", "type": "bridge"}`)
+	writeFile(t, filepath.Join(netDir, "20-notype.conf"), `{"name": "notype"}`)
+
+	testCases := []struct {
+		rktErr      error
+		dataDir     string
+		initErr     error
+		network     string
+		invalidConf bool
+
+		runtimeReason string
+		networkReason string
+	}{
+		{
+			network: "good",
+		},
+		{
+			network: "default",
+		},
+		{
+			rktErr:        errors.New("rkt: not found"),
+			runtimeReason: reasonRktNotWorking,
+		},
+		{
+			dataDir:       filepath.Join(tmpDir, "missing"),
+			runtimeReason: reasonDataDirNotWritable,
+		},
+		{
+			initErr:       errors.New("systemd is not running"),
+			runtimeReason: reasonInitNotReady,
+		},
+		{
+			network:       "missing",
+			networkReason: reasonNetworkConfigNotFound,
+		},
+		{
+			network:       "notype",
+			networkReason: reasonNetworkConfigNotLoaded,
+		},
+		{
+			network:       "missing",
+			invalidConf:   true,
+			networkReason: reasonNetworkConfigNotLoaded,
+		},
+	}
+
+	for i, testCase := range testCases {
+		invalidConfPath := filepath.Join(netDir, "30-invalid.conf")
+		if testCase.invalidConf {
+			writeFile(t, invalidConfPath, `{"name": `)
+		} else {
+			os.Remove(invalidConfPath)
+		}
+
+		dataDir := tmpDir
+		if testCase.dataDir != "" {
+			dataDir = testCase.dataDir
+		}
+
+		mockCli := new(mocks.CLI)
+		mockCli.On("RunCommandContext", mock.Anything, "version", []string(nil)).Return([]string{"rkt Version: 1.29.0"}, testCase.rktErr)
+		mockInit := new(mocks.Init)
+		mockInit.On("Ready").Return(testCase.initErr)
+
+		r := &RktRuntime{
+			CLI:               mockCli,
+			Init:              mockInit,
+			dataDir:           dataDir,
+			networkPluginName: testCase.network,
+			localConfigDir:    tmpDir,
+		}
+
+		resp, err := r.Status(context.TODO(), &runtimeApi.StatusRequest{})
+		if err != nil {
+			t.Errorf("test case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		conditions := resp.Status.Conditions
+		if len(conditions) != 2 {
+			t.Errorf("test case %d: expected 2 conditions, got %v", i, conditions)
+			continue
+		}
+		for _, c := range []struct {
+			condition *runtimeApi.RuntimeCondition
+			typ       string
+			reason    string
+		}{
+			{conditions[0], runtimeApi.RuntimeReady, testCase.runtimeReason},
+			{conditions[1], runtimeApi.NetworkReady, testCase.networkReason},
+		} {
+			assert.Equal(t, c.typ, c.condition.Type, "test case %d", i)
+			assert.Equal(t, c.reason == "", c.condition.Status, "test case %d: %s", i, c.typ)
+			assert.Equal(t, c.reason, c.condition.Reason, "test case %d: %s", i, c.typ)
+			assert.Equal(t, c.reason == "", c.condition.Message == "", "test case %d: %s", i, c.typ)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// appStopPollInterval is how often the state of an app is checked while
+	// waiting for it to stop.
+	appStopPollInterval = 500 * time.Millisecond
+	// appKillTimeout is how long to wait for an app to go away after it has
+	// been sent SIGKILL.
+	appKillTimeout = 10 * time.Second
+
+	// appStopReasonFile is written in the app's info directory when rktlet had
+	// to kill it, so that ContainerStatus can report it.
+	appStopReasonFile = "rktlet-stop-reason"
+	reasonKilled      = "Killed"
+)
+
+// stopApp stops an app gracefully: its processes are sent SIGTERM, and are
+// given up to timeout to exit before being sent SIGKILL.
+// rkt is then asked to stop the app, so its state is updated.
+func (r *RktRuntime) stopApp(ctx context.Context, uuid, appName string, timeout time.Duration) error {
+	if pids, err := r.appPids(uuid, appName); err != nil || len(pids) == 0 {
+		// Nothing is running (anymore), just let rkt update the app state.
+		return r.rktAppStop(ctx, uuid, appName)
+	}
+
+	if timeout > 0 {
+		r.signalApp(uuid, appName, syscall.SIGTERM)
+		if r.waitAppExited(ctx, uuid, appName, timeout) {
+			return r.rktAppStop(ctx, uuid, appName)
+		}
+		glog.Infof("rkt: app %q of pod %q did not stop within %v, killing it", appName, uuid, timeout)
+	}
+
+	r.signalApp(uuid, appName, syscall.SIGKILL)
+	if err := r.setAppStopReason(uuid, appName, reasonKilled); err != nil {
+		glog.Warningf("rkt: unable to record stop reason of app %q in pod %q: %v", appName, uuid, err)
+	}
+	if !r.waitAppExited(ctx, uuid, appName, appKillTimeout) {
+		glog.Warningf("rkt: app %q of pod %q still running %v after being killed", appName, uuid, appKillTimeout)
+	}
+
+	return r.rktAppStop(ctx, uuid, appName)
+}
+
+func (r *RktRuntime) rktAppStop(ctx context.Context, uuid, appName string) error {
+	if output, err := r.RunCommandContext(ctx, "app", "stop", uuid, "--app="+appName); err != nil {
+		return cli.WrapError(err, "failed to stop app %q of pod %q, output: %s\n", appName, uuid, output)
+	}
+	return nil
+}
+
+// signalApp sends a signal to all the processes of an app.
+func (r *RktRuntime) signalApp(uuid, appName string, sig syscall.Signal) {
+	pids, err := r.appPids(uuid, appName)
+	if err != nil {
+		glog.Warningf("rkt: unable to list processes of app %q in pod %q: %v", appName, uuid, err)
+		return
+	}
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			glog.Warningf("rkt: unable to send %v to process %d of app %q in pod %q: %v", sig, pid, appName, uuid, err)
+		}
+	}
+}
+
+// waitAppExited polls the state of an app until it's not running anymore, or
+// the timeout expires. It returns whether the app exited.
+func (r *RktRuntime) waitAppExited(ctx context.Context, uuid, appName string, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(appStopPollInterval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := r.ContainerStatus(ctx, &runtimeApi.ContainerStatusRequest{ContainerId: buildContainerID(uuid, appName)})
+		if err != nil {
+			glog.Warningf("rkt: unable to get status of app %q in pod %q: %v", appName, uuid, err)
+		} else if resp.Status.State != runtimeApi.ContainerState_CONTAINER_RUNNING {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (r *RktRuntime) appStopReasonPath(uuid, appName string) string {
+	return filepath.Join(r.podDir(uuid), "appsinfo", appName, appStopReasonFile)
+}
+
+func (r *RktRuntime) setAppStopReason(uuid, appName, reason string) error {
+	return ioutil.WriteFile(r.appStopReasonPath(uuid, appName), []byte(reason), 0644)
+}
+
+// appStopReason returns the reason recorded by stopApp, if any.
+func (r *RktRuntime) appStopReason(uuid, appName string) string {
+	reason, err := ioutil.ReadFile(r.appStopReasonPath(uuid, appName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("rkt: unable to read stop reason of app %q in pod %q: %v", appName, uuid, err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(reason))
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	rktlib "github.com/rkt/rkt/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestStopContainerKillsAfterTimeout(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_stop")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	// An app which ignores SIGTERM.
+	app := exec.Command("sh", "-c", "trap '' TERM; exec sleep 100")
+	if err := app.Start(); err != nil {
+		t.Fatalf("unable to start app: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		app.Wait()
+		close(exited)
+	}()
+	defer app.Process.Kill()
+
+	// Wait for the shell to have set up the trap and exec'ed.
+	for i := 0; ; i++ {
+		comm, _ := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(app.Process.Pid), "comm"))
+		if strings.TrimSpace(string(comm)) == "sleep" {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("app didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mockCli := new(mocks.CLI)
+	r := &RktRuntime{CLI: mockCli, reader: cli.NewCLIReader(mockCli), dataDir: filepath.Join(tmpDir, "data")}
+	r.podCache = newPodCache(r, time.Minute)
+	podDir := r.podDir("1234")
+
+	writeFile(t, filepath.Join(podDir, "subcgroup"), "rktlet-abc.service")
+	writeFile(t, filepath.Join(podDir, "appsinfo", "0-foo", "manifest"), "")
+	writeFile(t, filepath.Join(util.CgroupRoot, "memory", "rktlet-abc.service/system.slice/0-foo.service", "cgroup.procs"), strconv.Itoa(app.Process.Pid))
+
+	appStatus := func(context.Context, string, ...string) []string {
+		state := rktlib.AppStateRunning
+		select {
+		case <-exited:
+			state = rktlib.AppStateExited
+		default:
+		}
+		status, _ := json.Marshal(rktlib.App{Name: "0-foo", State: state})
+		return []string{string(status)}
+	}
+	mockCli.On("RunCommandContext", mock.Anything, "app", []string{"status", "1234", "--app=0-foo", "--format=json"}).Return(appStatus, nil)
+	mockCli.On("RunCommandContext", mock.Anything, "app", []string{"stop", "1234", "--app=0-foo"}).Return(nil, nil)
+
+	_, err = r.StopContainer(context.TODO(), &runtimeApi.StopContainerRequest{ContainerId: "1234:0-foo", Timeout: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-exited:
+	default:
+		t.Errorf("expected the app to be killed")
+	}
+	mockCli.AssertExpectations(t)
+
+	resp, err := r.ContainerStatus(context.TODO(), &runtimeApi.ContainerStatusRequest{ContainerId: "1234:0-foo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, runtimeApi.ContainerState_CONTAINER_EXITED, resp.Status.State)
+	assert.Equal(t, reasonKilled, resp.Status.Reason)
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	appcschema "github.com/appc/spec/schema"
+	"github.com/golang/glog"
+	rkt "github.com/rkt/rkt/api/v1"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	reasonCompleted = "Completed"
+	reasonError     = "Error"
+	reasonOOMKilled = "OOMKilled"
+
+	// The termination message is limited like the kubelet does when it falls
+	// back to the logs of a container.
+	terminationMessageMaxLines = 80
+	terminationMessageMaxBytes = 2048
+	// terminationLogReadBytes is how much of the end of the log is read to
+	// find the last lines, as they are prefixed with a timestamp and a stream.
+	terminationLogReadBytes = 16 * 1024
+
+	kubernetesLogDirAnno  = "coreos.com/rkt/experiment/kubernetes-log-dir"
+	kubernetesLogPathAnno = "coreos.com/rkt/experiment/kubernetes-log-path"
+)
+
+// setTerminationStatus fills the reason and message of an exited container.
+func (r *RktRuntime) setTerminationStatus(uuid, appName string, status *runtimeApi.ContainerStatus) {
+	reason := r.appStopReason(uuid, appName)
+	if reason == "" && r.appOOMKilled(uuid, appName) {
+		reason = reasonOOMKilled
+	}
+	if reason == "" {
+		if status.ExitCode == 0 {
+			reason = reasonCompleted
+		} else {
+			reason = reasonError
+		}
+	}
+	status.Reason = reason
+
+	if reason == reasonCompleted {
+		return
+	}
+	message, err := r.appLogTail(uuid, appName)
+	if err != nil {
+		glog.V(4).Infof("rkt: unable to read the output of app %q in pod %q: %v", appName, uuid, err)
+		return
+	}
+	status.Message = message
+}
+
+// appOOMKilled returns whether the kernel OOM killer killed a process of the
+// app. This only works while the cgroup of the app is still around, which is
+// why watchAppOOM records OOM events as they happen.
+func (r *RktRuntime) appOOMKilled(uuid, appName string) bool {
+	cgroupPath, err := r.appCgroupPath(uuid, appName)
+	if err != nil {
+		return false
+	}
+	oomControl, err := readCgroupKeyedFile("memory", cgroupPath, "memory.oom_control")
+	if err != nil {
+		return false
+	}
+	return oomControl["oom_kill"] > 0
+}
+
+// watchAppOOM starts watching the memory cgroup of a running app for OOM
+// events, which are recorded as the stop reason of the app.
+func (r *RktRuntime) watchAppOOM(uuid, appName string) {
+	if r.oomWatcher == nil {
+		return
+	}
+	cgroupPath, err := r.appCgroupPath(uuid, appName)
+	if err == nil {
+		err = r.oomWatcher.watch(uuid, appName, cgroupPath)
+	}
+	if err != nil {
+		glog.V(4).Infof("rkt: unable to watch app %q in pod %q for OOM events: %v", appName, uuid, err)
+	}
+}
+
+// watchRunningAppsOOM starts watching the apps which are already running for
+// OOM events. StartContainer only watches the apps it starts, so this picks up
+// the apps started before rktlet restarted.
+func (r *RktRuntime) watchRunningAppsOOM(ctx context.Context) {
+	if r.oomWatcher == nil {
+		return
+	}
+	pods, err := r.listPods(ctx)
+	if err != nil {
+		glog.Warningf("rkt: unable to list pods to watch their apps for OOM events: %v", err)
+		return
+	}
+	for i := range pods {
+		p := &pods[i]
+		if !isKubernetesPod(p) || p.State != "running" {
+			continue
+		}
+		for _, app := range p.Apps {
+			if app.State != rkt.AppStateRunning || strings.HasPrefix(app.Name, internalAppPrefix) {
+				continue
+			}
+			r.watchAppOOM(p.UUID, app.Name)
+		}
+	}
+}
+
+// recordAppOOM records that an app ran out of memory.
+func (r *RktRuntime) recordAppOOM(uuid, appName string) {
+	glog.Infof("rkt: app %q in pod %q ran out of memory", appName, uuid)
+	if err := r.setAppStopReason(uuid, appName, reasonOOMKilled); err != nil {
+		glog.Warningf("rkt: unable to record stop reason of app %q in pod %q: %v", appName, uuid, err)
+	}
+}
+
+// readPodManifest reads the manifest of a pod from its directory.
+func (r *RktRuntime) readPodManifest(uuid string) (*appcschema.PodManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.podDir(uuid), "pod"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest appcschema.PodManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pod manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+// appLogPath returns the path of the log file rkt writes the output of an app
+// to, from the annotations set by RunPodSandbox and CreateContainer.
+func (r *RktRuntime) appLogPath(uuid, appName string) (string, error) {
+	manifest, err := r.readPodManifest(uuid)
+	if err != nil {
+		return "", err
+	}
+	logDir, ok := manifest.Annotations.Get(kubernetesLogDirAnno)
+	if !ok {
+		return "", fmt.Errorf("no log directory in pod manifest")
+	}
+	for _, app := range manifest.Apps {
+		if app.Name.String() != appName {
+			continue
+		}
+		logPath, ok := app.Annotations.Get(kubernetesLogPathAnno)
+		if !ok {
+			return "", fmt.Errorf("no log path for app %q in pod manifest", appName)
+		}
+		return filepath.Join(logDir, logPath), nil
+	}
+	return "", fmt.Errorf("app %q not found in pod manifest", appName)
+}
+
+// appLogTail returns the last lines of the output of an app.
+func (r *RktRuntime) appLogTail(uuid, appName string) (string, error) {
+	logPath, err := r.appLogPath(uuid, appName)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(-terminationLogReadBytes, io.SeekEnd)
+	if err != nil {
+		// The log is shorter than that.
+		offset, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	return tailLogMessage(data, offset > 0), nil
+}
+
+// tailLogMessage extracts the last lines of a log in the format rkt writes in
+// the k8s-plain log mode, e.g.:
+//   2017-06-26T16:25:38.667546831+02:00 stderr some output
+// If partial is true, the first line of data may be truncated and is skipped.
+func tailLogMessage(data []byte, partial bool) string {
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if partial && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	if len(lines) > terminationMessageMaxLines {
+		lines = lines[len(lines)-terminationMessageMaxLines:]
+	}
+
+	var messages []string
+	for _, line := range lines {
+		fields := strings.SplitN(string(line), " ", 3)
+		if len(fields) == 3 {
+			if _, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+				messages = append(messages, fields[2])
+				continue
+			}
+		}
+		messages = append(messages, string(line))
+	}
+
+	message := strings.Join(messages, "\n")
+	if len(message) > terminationMessageMaxBytes {
+		message = message[len(message)-terminationMessageMaxBytes:]
+	}
+	return message
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appcschema "github.com/appc/spec/schema"
+	actypes "github.com/appc/spec/schema/types"
+	"github.com/kubernetes-incubator/rktlet/rktlet/util"
+	"github.com/stretchr/testify/assert"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestSetTerminationStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rktlet_termination")
+	if err != nil {
+		t.Fatalf("unable to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCgroupRoot := util.CgroupRoot
+	util.CgroupRoot = filepath.Join(tmpDir, "cgroup")
+	defer func() { util.CgroupRoot = origCgroupRoot }()
+
+	r := &RktRuntime{dataDir: filepath.Join(tmpDir, "data")}
+	podDir := r.podDir("1234")
+	logDir := filepath.Join(tmpDir, "logs")
+	appCgroup := filepath.Join(util.CgroupRoot, "memory", "rktlet-abc.service/system.slice/0-foo.service")
+
+	manifest := appcschema.BlankPodManifest()
+	manifest.Annotations.Set(kubernetesLogDirAnno, logDir)
+	app := appcschema.RuntimeApp{
+		Name:  *actypes.MustACName("0-foo"),
+		Image: appcschema.RuntimeImage{ID: *actypes.NewHashSHA512([]byte("image"))},
+	}
+	app.Annotations.Set(kubernetesLogPathAnno, "foo_0.log")
+	manifest.Apps = append(manifest.Apps, app)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("unable to marshal pod manifest: %v", err)
+	}
+	writeFile(t, filepath.Join(podDir, "pod"), string(data))
+	writeFile(t, filepath.Join(podDir, "subcgroup"), "rktlet-abc.service")
+	writeFile(t, filepath.Join(podDir, "appsinfo", "0-foo", "manifest"), "")
+	writeFile(t, filepath.Join(logDir, "foo_0.log"),
+		"2017-06-26T16:25:38.667546831+02:00 stdout starting\n"+
+			"2017-06-26T16:25:39.667546831+02:00 stderr panic: oops\n")
+
+	testCases := []struct {
+		exitCode   int32
+		oomKill    string
+		stopReason string
+
+		reason  string
+		message string
+	}{
+		{
+			exitCode: 0,
+			reason:   reasonCompleted,
+		},
+		{
+			exitCode: 2,
+			reason:   reasonError,
+			message:  "starting\npanic: oops",
+		},
+		{
+			exitCode: 137,
+			oomKill:  "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n",
+			reason:   reasonOOMKilled,
+			message:  "starting\npanic: oops",
+		},
+		{
+			exitCode:   137,
+			stopReason: reasonOOMKilled,
+			reason:     reasonOOMKilled,
+			message:    "starting\npanic: oops",
+		},
+		{
+			exitCode:   137,
+			stopReason: reasonKilled,
+			reason:     reasonKilled,
+			message:    "starting\npanic: oops",
+		},
+	}
+
+	for i, testCase := range testCases {
+		os.RemoveAll(appCgroup)
+		if testCase.oomKill != "" {
+			writeFile(t, filepath.Join(appCgroup, "memory.oom_control"), testCase.oomKill)
+		}
+		os.Remove(r.appStopReasonPath("1234", "0-foo"))
+		if testCase.stopReason != "" {
+			if err := r.setAppStopReason("1234", "0-foo", testCase.stopReason); err != nil {
+				t.Fatalf("unable to set stop reason: %v", err)
+			}
+		}
+
+		status := &runtimeApi.ContainerStatus{ExitCode: testCase.exitCode}
+		r.setTerminationStatus("1234", "0-foo", status)
+		assert.Equal(t, testCase.reason, status.Reason, "test case %d", i)
+		assert.Equal(t, testCase.message, status.Message, "test case %d", i)
+	}
+}
+
+func TestTailLogMessage(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("2017-06-26T16:25:38.667546831+02:00 stdout line %d", i))
+	}
+	log := []byte(strings.Join(lines, "\n") + "\n")
+
+	message := tailLogMessage(log, false)
+	messageLines := strings.Split(message, "\n")
+	assert.Len(t, messageLines, terminationMessageMaxLines)
+	assert.Equal(t, "line 20", messageLines[0])
+	assert.Equal(t, "line 99", messageLines[len(messageLines)-1])
+
+	assert.Equal(t, "line 99", tailLogMessage([]byte("ine 98\n2017-06-26T16:25:38.667546831+02:00 stdout line 99\n"), true))
+	assert.Equal(t, "not rkt's format", tailLogMessage([]byte("not rkt's format\n"), false))
+
+	long := tailLogMessage([]byte(strings.Repeat("x", 3*terminationMessageMaxBytes)), false)
+	assert.Len(t, long, terminationMessageMaxBytes)
+}
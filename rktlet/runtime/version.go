@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli"
+	"github.com/kubernetes-incubator/rktlet/version"
+	"golang.org/x/net/context"
+
+	runtimeApi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// kubeAPIVersion is the version of the kubelet runtime API, the kubelet
+	// expects it to be 0.1.0.
+	kubeAPIVersion = "0.1.0"
+
+	// minimumRktVersion is the oldest rkt release providing all the `rkt app`
+	// subcommands rktlet relies on, starting with `rkt app sandbox`.
+	minimumRktVersion = "1.25.0"
+
+	// unknownRktVersion is reported when `rkt version` couldn't be parsed.
+	unknownRktVersion = "unknown"
+
+	rktVersionPrefix = "rkt Version:"
+)
+
+func (r *RktRuntime) Version(ctx context.Context, req *runtimeApi.VersionRequest) (*runtimeApi.VersionResponse, error) {
+	return &runtimeApi.VersionResponse{
+		Version:           kubeAPIVersion,
+		RuntimeName:       "rkt",
+		RuntimeVersion:    r.rktVersion,
+		RuntimeApiVersion: version.Version,
+	}, nil
+}
+
+// checkRktVersion gets the version of rkt, and returns an error if it's too
+// old to be used by rktlet. An unknown version is only logged, in case a
+// future rkt changes the output of `rkt version`.
+func checkRktVersion(c cli.CLI) (string, error) {
+	rktVersion, err := getRktVersion(c)
+	if err != nil {
+		glog.Errorf("rkt: unable to determine the version of rkt, rkt >= %s is required: %v", minimumRktVersion, err)
+		return unknownRktVersion, nil
+	}
+
+	if rktVersion.LessThan(*semver.Must(semver.NewVersion(minimumRktVersion))) {
+		return "", fmt.Errorf("rkt %s is not supported, rkt >= %s is required", rktVersion, minimumRktVersion)
+	}
+	glog.Infof("rkt: using rkt %s", rktVersion)
+	return rktVersion.String(), nil
+}
+
+// getRktVersion parses the version of rkt out of `rkt version`, e.g.:
+//   rkt Version: 1.29.0
+//   appc Version: 0.8.11
+//   Go Version: go1.8.3
+//   Go OS/Arch: linux/amd64
+//   Features: -TPM +SDJOURNAL
+func getRktVersion(c cli.CLI) (*semver.Version, error) {
+	output, err := c.RunCommand("version")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range output {
+		if !strings.HasPrefix(line, rktVersionPrefix) {
+			continue
+		}
+		// Development builds are suffixed with e.g. "+git".
+		return semver.NewVersion(strings.TrimSpace(strings.TrimPrefix(line, rktVersionPrefix)))
+	}
+	return nil, fmt.Errorf("no rkt version in %q", output)
+}
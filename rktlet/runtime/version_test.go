@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-incubator/rktlet/rktlet/cli/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRktVersion(t *testing.T) {
+	testCases := []struct {
+		output []string
+		err    error
+
+		version string
+		failed  bool
+	}{
+		{
+			output:  []string{"rkt Version: 1.29.0", "appc Version: 0.8.11", "Go Version: go1.8.3"},
+			version: "1.29.0",
+		},
+		{
+			output:  []string{"rkt Version: 1.29.0+git2c2c1fb", "appc Version: 0.8.11"},
+			version: "1.29.0+git2c2c1fb",
+		},
+		{
+			output: []string{"rkt Version: 1.20.0", "appc Version: 0.8.9"},
+			failed: true,
+		},
+		{
+			output:  []string{"something else"},
+			version: unknownRktVersion,
+		},
+		{
+			err:     errors.New("rkt: not found"),
+			version: unknownRktVersion,
+		},
+	}
+
+	for i, testCase := range testCases {
+		mockCli := new(mocks.CLI)
+		mockCli.On("RunCommand", "version", []string(nil)).Return(testCase.output, testCase.err)
+
+		version, err := checkRktVersion(mockCli)
+		assert.Equal(t, testCase.failed, err != nil, "test case %d: %v", i, err)
+		assert.Equal(t, testCase.version, version, "test case %d", i)
+	}
+}
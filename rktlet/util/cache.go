@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// listTimeout is how long a list may take before it's given up, so a hung
+// list doesn't hold up every caller.
+const listTimeout = 2 * time.Minute
+
+// ListCache caches the result of an expensive list operation, such as
+// `rkt list`. The result is refreshed periodically by Run, and as soon as it's
+// needed after being invalidated.
+type ListCache struct {
+	list          func(context.Context) (interface{}, error)
+	refreshPeriod time.Duration
+
+	// listing holds a value while listing, so concurrent callers share the
+	// result of a single list. Unlike a mutex, waiting for it can be given
+	// up.
+	listing chan struct{}
+
+	lock     sync.Mutex
+	result   interface{}
+	listedAt time.Time
+	valid    bool
+	// generation is incremented on every invalidation, so the result of a
+	// list started before an invalidation isn't considered valid.
+	generation uint64
+}
+
+// NewListCache creates a cache of the result of list. The list is given the
+// context of the caller it's run for.
+func NewListCache(list func(context.Context) (interface{}, error), refreshPeriod time.Duration) *ListCache {
+	return &ListCache{
+		list:          list,
+		refreshPeriod: refreshPeriod,
+		listing:       make(chan struct{}, 1),
+	}
+}
+
+// Get returns the cached result, listing again if it was invalidated or if it
+// wasn't refreshed for too long. The result must not be modified. It returns
+// the error of the context if it's done before a list is available.
+func (c *ListCache) Get(ctx context.Context) (interface{}, error) {
+	if result, ok := c.cached(); ok {
+		return result, nil
+	}
+
+	select {
+	case c.listing <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.listing }()
+
+	// Another caller may have listed while we were waiting.
+	if result, ok := c.cached(); ok {
+		return result, nil
+	}
+	return c.relist(ctx)
+}
+
+// Invalidate makes the next Get list again. It must be called after every
+// change to what's listed.
+func (c *ListCache) Invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.valid = false
+}
+
+// Run refreshes the cache periodically. It never returns.
+func (c *ListCache) Run() {
+	ticker := time.NewTicker(c.refreshPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.listing <- struct{}{}
+		if _, err := c.relist(context.Background()); err != nil {
+			glog.Warningf("unable to refresh cache: %v", err)
+		}
+		<-c.listing
+	}
+}
+
+// cached returns the cached result if it's valid. Results older than two
+// refresh periods are considered invalid, in case Run isn't keeping up.
+func (c *ListCache) cached() (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.valid || time.Since(c.listedAt) > 2*c.refreshPeriod {
+		return nil, false
+	}
+	return c.result, true
+}
+
+// relist lists and stores the result, giving up after listTimeout. listing
+// must be held.
+func (c *ListCache) relist(ctx context.Context) (interface{}, error) {
+	c.lock.Lock()
+	generation := c.generation
+	c.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+	result, err := c.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if generation == c.generation {
+		c.result = result
+		c.listedAt = time.Now()
+		c.valid = true
+	}
+	return result, nil
+}
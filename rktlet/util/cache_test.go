@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestListCache(t *testing.T) {
+	var lists int32
+	var listErr error
+	cache := NewListCache(func(context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&lists, 1)
+		return n, listErr
+	}, time.Hour)
+
+	// Concurrent callers share the first list.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cache.Get(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), result)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lists))
+
+	cache.Invalidate()
+	result, err := cache.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+
+	// Errors aren't cached.
+	cache.Invalidate()
+	listErr = errors.New("rkt: lock contention")
+	_, err = cache.Get(context.Background())
+	assert.Error(t, err)
+	listErr = nil
+	result, err = cache.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), result)
+}
+
+func TestListCacheInvalidatedWhileListing(t *testing.T) {
+	listing := make(chan struct{})
+	proceed := make(chan struct{})
+	var lists int32
+	cache := NewListCache(func(context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&lists, 1)
+		if n == 1 {
+			close(listing)
+			<-proceed
+		}
+		return n, nil
+	}, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.Get(context.Background())
+	}()
+
+	// A change happens while the first list is running: its result may not
+	// reflect it, so it mustn't be served afterwards.
+	<-listing
+	cache.Invalidate()
+	close(proceed)
+	<-done
+
+	result, err := cache.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+}
+
+func TestListCacheContext(t *testing.T) {
+	listing := make(chan struct{})
+	proceed := make(chan struct{})
+	var lists int32
+	cache := NewListCache(func(ctx context.Context) (interface{}, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := atomic.AddInt32(&lists, 1)
+		if n == 1 {
+			close(listing)
+			select {
+			case <-proceed:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return n, nil
+	}, time.Hour)
+
+	go cache.Get(context.Background())
+	<-listing
+
+	// Callers waiting for a hung list give up with their context.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := cache.Get(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	close(proceed)
+
+	// The list is given the context of the caller.
+	cache.Invalidate()
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = cache.Get(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// diskByUUIDDir holds symlinks to block devices named after the UUID of the
+// filesystem they contain.
+var diskByUUIDDir = "/dev/disk/by-uuid"
+
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// DiskUsage walks the tree rooted at root and returns the number of bytes
+// allocated on disk and the number of inodes used by it, similar to `du`.
+// Hard links are only accounted for once.
+func DiskUsage(root string) (bytes, inodes uint64, err error) {
+	seen := make(map[inodeKey]struct{})
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while walking a live tree; that's fine.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			bytes += uint64(info.Size())
+			inodes++
+			return nil
+		}
+
+		if stat.Nlink > 1 {
+			key := inodeKey{uint64(stat.Dev), uint64(stat.Ino)}
+			if _, ok := seen[key]; ok {
+				return nil
+			}
+			seen[key] = struct{}{}
+		}
+
+		// st_blocks is always in units of 512 bytes.
+		bytes += uint64(stat.Blocks) * 512
+		inodes++
+		return nil
+	})
+
+	return bytes, inodes, err
+}
+
+// FsUUID returns the UUID of the filesystem the given path is on, as listed in
+// /dev/disk/by-uuid. This is what cAdvisor uses to identify filesystems.
+func FsUUID(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+
+	entries, err := ioutil.ReadDir(diskByUUIDDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		var dev syscall.Stat_t
+		// Stat follows the symlink to the device node.
+		if err := syscall.Stat(filepath.Join(diskByUUIDDir, entry.Name()), &dev); err != nil {
+			continue
+		}
+		if dev.Mode&syscall.S_IFMT == syscall.S_IFBLK && uint64(dev.Rdev) == uint64(st.Dev) {
+			return entry.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no filesystem UUID found for %q", path)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// KeyedMutex is a set of mutexes identified by a key, e.g. a pod UUID. The
+// mutexes only exist while they are held or waited for. The zero value is
+// ready to use.
+type KeyedMutex struct {
+	lock    sync.Mutex
+	mutexes map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	// held has an element while the mutex is held, so it can be waited for
+	// along with a context.
+	held chan struct{}
+	// refs is the number of holders and waiters.
+	refs int
+}
+
+// Lock locks the mutex of the given key, and returns the function unlocking
+// it.
+func (m *KeyedMutex) Lock(key string) func() {
+	unlock, _ := m.LockContext(context.Background(), key)
+	return unlock
+}
+
+// LockContext locks the mutex of the given key like Lock, but gives up with
+// the error of the context if it's done first.
+func (m *KeyedMutex) LockContext(ctx context.Context, key string) (func(), error) {
+	m.lock.Lock()
+	if m.mutexes == nil {
+		m.mutexes = make(map[string]*keyedMutexEntry)
+	}
+	entry, ok := m.mutexes[key]
+	if !ok {
+		entry = &keyedMutexEntry{held: make(chan struct{}, 1)}
+		m.mutexes[key] = entry
+	}
+	entry.refs++
+	m.lock.Unlock()
+
+	select {
+	case entry.held <- struct{}{}:
+	case <-ctx.Done():
+		m.release(key, entry)
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-entry.held
+		m.release(key, entry)
+	}, nil
+}
+
+// release drops a reference to the mutex of the given key, freeing it once
+// it's neither held nor waited for.
+func (m *KeyedMutex) release(key string, entry *keyedMutexEntry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entry.refs--
+	if entry.refs == 0 {
+		delete(m.mutexes, key)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var m KeyedMutex
+
+	unlockFoo := m.Lock("foo")
+
+	// Other keys aren't blocked.
+	unlockBar := m.Lock("bar")
+	unlockBar()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := m.Lock("foo")
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("the mutex was locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockFoo()
+	<-locked
+
+	// Concurrent holders of one key are serialized.
+	var wg sync.WaitGroup
+	var holders, maxHolders int
+	var countLock sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := m.Lock("foo")
+			defer unlock()
+
+			countLock.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			countLock.Unlock()
+			time.Sleep(time.Millisecond)
+			countLock.Lock()
+			holders--
+			countLock.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, maxHolders)
+
+	// Waiting for a mutex stops when the context is done.
+	unlockFoo = m.Lock("foo")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := m.LockContext(ctx, "foo")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	unlockFoo()
+
+	// Unused mutexes are freed.
+	assert.Empty(t, m.mutexes)
+}